@@ -0,0 +1,149 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"strings"
+)
+
+// ANONYMOUS is the principal of unauthenticated requests, e.g. those of the
+// HTTP API or of a ZeroMQ address without CURVE. Authenticated ZeroMQ clients
+// are named by their CURVE public key.
+const ANONYMOUS = "anonymous"
+
+// Operations that ACL rules grant.
+const (
+	READ     = "read"    // read or subscribe to a stream
+	WRITE    = "write"   // append to a stream
+	DELETE   = "delete"  // delete a stream
+	READ_ALL = "readAll" // read or subscribe to all events, or those of a type
+	ADMIN    = "admin"   // rebuild type indexes, back up and shut down
+)
+
+var operations = []string{READ, WRITE, DELETE, READ_ALL, ADMIN}
+
+// SHUTDOWN, REBUILD and BACKUP are granted by ADMIN rules, but unlike other
+// operations they are denied when there is no ACL: stopping the server
+// remotely, or loading it with a rebuild of its type indexes or a backup, must
+// be allowed explicitly.
+const (
+	SHUTDOWN = "shutdown"
+	REBUILD  = "rebuild"
+	BACKUP   = "backup"
+)
+
+var adminOperations = []string{SHUTDOWN, REBUILD, BACKUP}
+
+// ANY matches every principal, stream or type in an ACL rule.
+const ANY = "*"
+
+// AclRule grants operations to principals, on the streams and event types
+// (the categories of events) it lists. No streams or types means all of them.
+// A request on all streams or types, such as reading all events or deleting a
+// stream, needs a rule covering all of them.
+type AclRule struct {
+	Principals []string `json:"principals"`
+	Operations []string `json:"operations"`
+	Streams    []string `json:"streams"`
+	Types      []string `json:"types"`
+}
+
+// ACL allows a request when one of its rules does, and denies it otherwise.
+type ACL struct {
+	rules []AclRule
+}
+
+func NewACL(rules []AclRule) (*ACL, error) {
+	for i, rule := range rules {
+		if len(rule.Principals) == 0 {
+			return nil, errors.New(fmt.Sprintf("Rule %v has no principals.", i))
+		}
+		for _, operation := range rule.Operations {
+			if !contains(operations, operation) {
+				return nil, errors.New(fmt.Sprintf("Rule %v has an unknown operation: %v, expected one of %v.", i, operation, operations))
+			}
+		}
+		for _, stream := range rule.Streams {
+			if _, err := uuid.FromString(stream); stream != ANY && err != nil {
+				return nil, errors.New(fmt.Sprintf("Rule %v has a wrong stream id: %v.", i, stream))
+			}
+		}
+	}
+	return &ACL{rules}, nil
+}
+
+// ReadACLFile reads the rules of an ACL from a JSON array, e.g.
+// [{"principals": ["*"], "operations": ["read"], "types": ["OrderPlaced"]}].
+func ReadACLFile(path string) (*ACL, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]AclRule, 0)
+	if err = json.Unmarshal(content, &rules); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	acl, err := NewACL(rules)
+	if err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	return acl, nil
+}
+
+// Allows tells whether principal may run operation on a stream and a type of
+// events, uuid.Nil and "" meaning all of them.
+func (me *ACL) Allows(principal string, operation string, streamId uuid.UUID, typeId string) bool {
+	stream := ANY
+	if streamId != uuid.Nil {
+		stream = streamId.String()
+	}
+	if typeId == "" {
+		typeId = ANY
+	}
+	if contains(adminOperations, operation) {
+		operation = ADMIN
+	}
+	for _, rule := range me.rules {
+		if (contains(rule.Principals, principal) || contains(rule.Principals, ANY)) &&
+			contains(rule.Operations, operation) &&
+			covers(rule.Streams, stream) && covers(rule.Types, typeId) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// covers tells whether the streams or types of a rule include value, ANY for
+// all of them.
+func covers(values []string, value string) bool {
+	return len(values) == 0 || contains(values, ANY) || contains(values, value)
+}
+
+// requiresACL is the error of an admin operation when there is no ACL.
+func requiresACL(operation string) error {
+	return errors.New(fmt.Sprintf("Forbidden: %s%s requires an ACL granting admin.", strings.ToUpper(operation[:1]), operation[1:]))
+}
+
+// forbidden is the error of a request the ACL denies.
+func forbidden(principal string, operation string, streamId uuid.UUID, typeId string) error {
+	target := ""
+	if streamId != uuid.Nil {
+		target += " on stream " + streamId.String()
+	}
+	if typeId != "" {
+		target += " of type " + typeId
+	}
+	return errors.New(fmt.Sprintf("Forbidden: %s may not %s%s.", principal, operation, target))
+}
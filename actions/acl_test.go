@@ -0,0 +1,95 @@
+package actions
+
+import (
+	data "../data"
+	serializer "../serializer"
+	storage "../storage"
+	"github.com/satori/go.uuid"
+	"strings"
+	"testing"
+)
+
+func TestAclAllowsWhatARuleCovers(t *testing.T) {
+	//Arrange
+	streamId, otherStreamId := uuid.NewV4(), uuid.NewV4()
+	acl, err := NewACL([]AclRule{
+		{Principals: []string{ANY}, Operations: []string{READ}},
+		{Principals: []string{"writer"}, Operations: []string{WRITE}, Streams: []string{streamId.String()}, Types: []string{"OrderPlaced"}},
+		{Principals: []string{"reporting"}, Operations: []string{READ_ALL}, Types: []string{"OrderPlaced"}},
+		{Principals: []string{"admin"}, Operations: []string{WRITE, DELETE, READ_ALL, ADMIN}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Act & Assert
+	cases := []struct {
+		principal string
+		operation string
+		streamId  uuid.UUID
+		typeId    string
+		allowed   bool
+	}{
+		{ANONYMOUS, READ, streamId, "", true},
+		{ANONYMOUS, WRITE, streamId, "OrderPlaced", false},
+		{"writer", WRITE, streamId, "OrderPlaced", true},
+		{"writer", WRITE, streamId, "OrderCancelled", false},
+		{"writer", WRITE, otherStreamId, "OrderPlaced", false},
+		{"writer", DELETE, streamId, "", false},
+		{"reporting", READ_ALL, uuid.Nil, "OrderPlaced", true},
+		{"reporting", READ_ALL, uuid.Nil, "", false},
+		{"admin", DELETE, otherStreamId, "", true},
+		{"admin", ADMIN, uuid.Nil, "", true},
+		{"writer", ADMIN, uuid.Nil, "", false},
+	}
+	for _, c := range cases {
+		if allowed := acl.Allows(c.principal, c.operation, c.streamId, c.typeId); allowed != c.allowed {
+			t.Errorf("%s %s on %v of type %q: allowed %v, expected %v", c.principal, c.operation, c.streamId, c.typeId, allowed, c.allowed)
+		}
+	}
+}
+
+func TestNewAclChecksRules(t *testing.T) {
+	invalid := [][]AclRule{
+		{{Operations: []string{READ}}},
+		{{Principals: []string{ANY}, Operations: []string{"shutdown"}}},
+		{{Principals: []string{ANY}, Operations: []string{READ}, Streams: []string{"orders"}}},
+	}
+
+	for _, rules := range invalid {
+		if _, err := NewACL(rules); err == nil {
+			t.Errorf("NewACL accepted %+v", rules)
+		}
+	}
+}
+
+func TestHandlerEnforcesItsAcl(t *testing.T) {
+	//Arrange
+	acl, _ := NewACL([]AclRule{
+		{Principals: []string{ANY}, Operations: []string{READ}},
+		{Principals: []string{"writer"}, Operations: []string{WRITE}},
+	})
+	handler := NewActionsHandler(storage.NewInMemoryStorage(), serializer.NewPassthruSerializer())
+	handler.SetACL(acl)
+	streamId := uuid.NewV4()
+	event := func(payload string) data.Event {
+		return data.Event{AggregateId: streamId, Payload: []byte(payload)}
+	}
+
+	//Act
+	writerErr := handler.As("writer").AddEvent(event("AnEvent 1"), NO_EXPECTEDVERSION)
+	anonymousErr := handler.AddEvent(event("AnEvent 2"), NO_EXPECTEDVERSION)
+	events, readErr := handler.RetrieveFor(streamId)
+	_, readAllErr := handler.As("writer").RetrieveAll()
+	deleteErr := handler.As("writer").DeleteStream(streamId, NO_EXPECTEDVERSION)
+
+	//Assert
+	if writerErr != nil || readErr != nil || len(events) != 1 {
+		t.Fatalf("Write failed with %v, read %v events with %v", writerErr, len(events), readErr)
+	}
+	for _, err := range []error{anonymousErr, readAllErr, deleteErr} {
+		if err == nil || !strings.HasPrefix(err.Error(), "Forbidden: ") {
+			t.Errorf("Forbidden request failed with %v", err)
+		}
+	}
+}
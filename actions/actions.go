@@ -7,27 +7,127 @@ import (
 	"errors"
 	"fmt"
 	"github.com/satori/go.uuid"
+	"math"
+	"strings"
+	"sync"
 	"time"
 )
 
 const NO_EXPECTEDVERSION = uint32(0xFFFFFFFF)
 
+// STREAM_DELETED_TYPE is the type of the tombstone DeleteStream appends. Types
+// starting with $ are reserved and can't be appended by clients.
+const STREAM_DELETED_TYPE = data.STREAM_DELETED_TYPE
+
+// InvalidEventError is the error of AddEvent for an event that can't be
+// appended whatever the state of the store, e.g. one without a type.
+type InvalidEventError struct {
+	Reason string
+}
+
+func (me *InvalidEventError) Error() string {
+	return me.Reason
+}
+
 var mapLock chan int = make(chan int, 1)
 var streamsLock map[string]chan int = make(map[string]chan int)
 
 type Handler interface {
 	AddEvent(data.Event, uint32) error
 	RetrieveFor(uuid.UUID) ([]*data.Event, error)
+	RetrieveStreamFrom(uuid.UUID, uint32, int) ([]*data.Event, uint32, error)
+	StreamVersion(uuid.UUID) (uint32, error)
 	RetrieveAll() ([]*data.Event, error)
+	RetrieveAllFrom(uint64, int) ([]*data.Event, error)
+	EventCount() (uint64, error)
+	RebuildTypeIndexes() error
+	Backup(string) (uint64, error)
+	Subscribe(uint64, SubscriptionFilter, <-chan struct{}, func(uint64, *data.Event) error) error
+	DeleteStream(uuid.UUID, uint32) error
+	As(string) Handler
+	Authorize(string, uuid.UUID, string) error
+}
+
+// SubscriptionFilter selects the events of a subscription: those of a stream,
+// those of a type, or all events when neither is set.
+type SubscriptionFilter struct {
+	StreamId uuid.UUID
+	TypeId   string
+}
+
+// Operation is what the ACL must grant to subscribe: READ for a stream,
+// READ_ALL otherwise.
+func (me SubscriptionFilter) Operation() string {
+	if me.StreamId != uuid.Nil {
+		return READ
+	}
+	return READ_ALL
+}
+
+func (me SubscriptionFilter) matches(event *storage.StoredEvent) bool {
+	if me.StreamId != uuid.Nil && event.StreamId != me.StreamId {
+		return false
+	}
+	return me.TypeId == "" || event.TypeId == me.TypeId
 }
 
+// notifier wakes up subscribers when events are appended: the channel it
+// hands out is closed, then replaced, on each notification.
+type notifier struct {
+	lock    sync.Mutex
+	changed chan struct{}
+}
+
+func (me *notifier) wait() <-chan struct{} {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	return me.changed
+}
+
+func (me *notifier) notify() {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	close(me.changed)
+	me.changed = make(chan struct{})
+}
+
+// ActionsHandler runs requests for its principal, ANONYMOUS unless obtained
+// with As, within the limits of its ACL. Without ACL every request is allowed.
 type ActionsHandler struct {
 	storage    storage.Storage
 	serializer serializer.Serializer
+	appended   *notifier
+	acl        *ACL
+	principal  string
 }
 
 func NewActionsHandler(storage storage.Storage, serializer serializer.Serializer) *ActionsHandler {
-	return &ActionsHandler{storage, serializer}
+	return &ActionsHandler{storage, serializer, &notifier{changed: make(chan struct{})}, nil, ANONYMOUS}
+}
+
+// SetACL restricts the requests of the handler and of those it returns from
+// then on with As.
+func (me *ActionsHandler) SetACL(acl *ACL) {
+	me.acl = acl
+}
+
+// As returns a handler running requests for principal, sharing the storage,
+// subscriptions and ACL of this one.
+func (me ActionsHandler) As(principal string) Handler {
+	me.principal = principal
+	return &me
+}
+
+// Authorize fails with a "Forbidden" error unless the principal of the handler
+// may run operation on a stream and a type, uuid.Nil and "" meaning all.
+func (me ActionsHandler) Authorize(operation string, streamId uuid.UUID, typeId string) error {
+	if me.acl == nil && contains(adminOperations, operation) {
+		return requiresACL(operation)
+	}
+	if me.acl == nil || me.acl.Allows(me.principal, operation, streamId, typeId) {
+		return nil
+	}
+	return forbidden(me.principal, operation, streamId, typeId)
 }
 
 func lockStream(streamName string) {
@@ -59,15 +159,36 @@ func (me ActionsHandler) AddEvent(event data.Event, expectedVersion uint32) erro
 	if err != nil {
 		return err
 	}
+	if typeId == "" {
+		return &InvalidEventError{"Events must have a type."}
+	}
+	if strings.HasPrefix(typeId, "$") {
+		return &InvalidEventError{"Event types starting with $ are reserved: " + typeId}
+	}
+	if err = me.Authorize(WRITE, event.AggregateId, typeId); err != nil {
+		return err
+	}
 
-	serializedMetadata, _, err := me.serializer.Serialize(event.Metadata)
+	serializedMetadata, metadataTypeId, err := me.serializer.Serialize(event.Metadata)
 	if err != nil {
 		return err
 	}
 
+	return me.write(&storage.StoredEvent{
+		StreamId: event.AggregateId,
+		CreationTime: time.Now(),
+		TypeId: typeId,
+		Data: serializedPayload,
+		MetadataTypeId: metadataTypeId,
+		Metadata: serializedMetadata}, expectedVersion)
+}
+
+// write checks the expected version of the stream, which must be locked, then
+// writes the event and wakes up subscribers.
+func (me ActionsHandler) write(event *storage.StoredEvent, expectedVersion uint32) error {
 	if expectedVersion != NO_EXPECTEDVERSION {
-		ver, err := me.storage.StreamVersion(event.AggregateId)
-		if err != nil && err.Error()[0:9] != "NOT_FOUND" {
+		ver, err := me.storage.StreamVersion(event.StreamId)
+		if err != nil && !strings.HasPrefix(err.Error(), "NOT_FOUND") {
 			return err
 		}
 		if ver != expectedVersion {
@@ -75,51 +196,130 @@ func (me ActionsHandler) AddEvent(event data.Event, expectedVersion uint32) erro
 		}
 	}
 
-	return me.storage.Write(&storage.StoredEvent{
-		StreamId: event.AggregateId,
+	err := me.storage.Write(event)
+	if err == nil {
+		me.appended.notify()
+	}
+	return err
+}
+
+// DeleteStream appends a STREAM_DELETED_TYPE tombstone to the stream. Events
+// are never removed: reads of the stream skip its events up to its last
+// tombstone, included, while reads of all events and subscriptions still get
+// them along with the tombstone. Appending afterwards starts the stream over,
+// versions going on from the tombstone's.
+func (me ActionsHandler) DeleteStream(streamId uuid.UUID, expectedVersion uint32) error {
+	if err := me.Authorize(DELETE, streamId, ""); err != nil {
+		return err
+	}
+	streamName := streamId.String()
+
+	lockStream(streamName)
+	defer unlockStream(streamName)
+
+	return me.write(&storage.StoredEvent{
+		StreamId: streamId,
 		CreationTime: time.Now(),
-		TypeId: typeId,
-		Data: serializedPayload,
-		Metadata: serializedMetadata})
+		TypeId: STREAM_DELETED_TYPE,
+		Data: []byte{}}, expectedVersion)
 }
 
+// RetrieveFor returns the events of a stream after its last tombstone.
 func (me ActionsHandler) RetrieveFor(aggregateId uuid.UUID) ([]*data.Event, error) {
+	events, _, err := me.RetrieveStreamFrom(aggregateId, 1, math.MaxInt32)
+	return events, err
+}
+
+// RetrieveStreamFrom returns up to count events of a stream from version on,
+// only deserializing those, and the version of the first event readers see:
+// the one after the last tombstone of the stream. Events before it are
+// skipped, the first event returned has the greater of both versions.
+func (me ActionsHandler) RetrieveStreamFrom(aggregateId uuid.UUID, version uint32, count int) ([]*data.Event, uint32, error) {
+	if err := me.Authorize(READ, aggregateId, ""); err != nil {
+		return nil, 0, err
+	}
 	results, err := me.storage.ReadStream(aggregateId)
-	if err != nil && err.Error()[0:9] == "NOT_FOUND" {
-		return make([]*data.Event, 0), nil
+	if err != nil && strings.HasPrefix(err.Error(), "NOT_FOUND") {
+		return make([]*data.Event, 0), 1, nil
 	}
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	first := afterLastTombstone(results) + 1
+	if version < first {
+		version = first
+	}
+	if uint64(version) > uint64(len(results)) {
+		return make([]*data.Event, 0), first, nil
+	}
+	results = results[version-1:]
+	if len(results) > count {
+		results = results[:count]
 	}
+	events, err := me.deserialize(results)
+	return events, first, err
+}
 
-	events := make([]*data.Event, 0)
-	for _, storedEvent := range results {
-		event, err := me.serializer.Deserialize(storedEvent.Data, storedEvent.TypeId)
-		if err != nil {
-			return nil, err
-		}
-		metadata, err := me.serializer.Deserialize(storedEvent.Metadata, storedEvent.MetadataTypeId)
-		if err != nil {
-			return nil, err
+// afterLastTombstone is the index of the event following the last tombstone
+// of a stream, 0 when it has none.
+func afterLastTombstone(storedEvents []*storage.StoredEvent) uint32 {
+	for i := len(storedEvents) - 1; i >= 0; i-- {
+		if storedEvents[i].TypeId == STREAM_DELETED_TYPE {
+			return uint32(i + 1)
 		}
-		events = append(events, &data.Event{
-			AggregateId: storedEvent.StreamId,
-			CreationTime: storedEvent.CreationTime,
-			Payload: event,
-			Metadata: metadata})
 	}
+	return 0
+}
 
-	return events, nil
+// StreamVersion is the version of the last event of a stream, 0 when the
+// stream is empty.
+func (me ActionsHandler) StreamVersion(aggregateId uuid.UUID) (uint32, error) {
+	if err := me.Authorize(READ, aggregateId, ""); err != nil {
+		return 0, err
+	}
+	version, err := me.storage.StreamVersion(aggregateId)
+	if err != nil && strings.HasPrefix(err.Error(), "NOT_FOUND") {
+		return storage.EMPTY_STREAM, nil
+	}
+	return version, err
 }
 
 func (me ActionsHandler) RetrieveAll() ([]*data.Event, error) {
+	if err := me.Authorize(READ_ALL, uuid.Nil, ""); err != nil {
+		return nil, err
+	}
 	results, err := me.storage.ReadAll()
 	if err != nil {
 		return nil, err
 	}
+	return me.deserialize(results)
+}
+
+// RetrieveAllFrom returns up to count events from global position position on,
+// without reading the others when the storage can read ranges.
+func (me ActionsHandler) RetrieveAllFrom(position uint64, count int) ([]*data.Event, error) {
+	if err := me.Authorize(READ_ALL, uuid.Nil, ""); err != nil {
+		return nil, err
+	}
+	results, err := storage.ReadRange(me.storage, position, count)
+	if err != nil {
+		return nil, err
+	}
+	return me.deserialize(results)
+}
 
-	events := make([]*data.Event, 0)
-	for _, storedEvent := range results {
+// EventCount is the number of events in the storage, the global position of
+// the next one.
+func (me ActionsHandler) EventCount() (uint64, error) {
+	if err := me.Authorize(READ_ALL, uuid.Nil, ""); err != nil {
+		return 0, err
+	}
+	return storage.EventCount(me.storage)
+}
+
+func (me ActionsHandler) deserialize(storedEvents []*storage.StoredEvent) ([]*data.Event, error) {
+	events := make([]*data.Event, 0, len(storedEvents))
+	for _, storedEvent := range storedEvents {
 		event, err := me.serializer.Deserialize(storedEvent.Data, storedEvent.TypeId)
 		if err != nil {
 			return nil, err
@@ -134,6 +334,69 @@ func (me ActionsHandler) RetrieveAll() ([]*data.Event, error) {
 			Payload: event,
 			Metadata: metadata})
 	}
-
 	return events, nil
 }
+
+func (me ActionsHandler) RebuildTypeIndexes() error {
+	if err := me.Authorize(REBUILD, uuid.Nil, ""); err != nil {
+		return err
+	}
+	return me.storage.RebuildTypeIndexes()
+}
+
+// Backup copies a snapshot of the storage to target, a directory or a .tar
+// file, and returns the global position the snapshot was frozen at.
+func (me ActionsHandler) Backup(target string) (uint64, error) {
+	if err := me.Authorize(BACKUP, uuid.Nil, ""); err != nil {
+		return 0, err
+	}
+	return storage.BackupTo(me.storage, target)
+}
+
+// Subscribe calls fn with the position and content of every event matching
+// filter from global position from on, in global order, then waits for the
+// events appended later. It returns once done is closed, or with the error of
+// fn or of a read.
+func (me ActionsHandler) Subscribe(from uint64, filter SubscriptionFilter, done <-chan struct{}, fn func(uint64, *data.Event) error) error {
+	if err := me.Authorize(filter.Operation(), filter.StreamId, filter.TypeId); err != nil {
+		return err
+	}
+	for {
+		changed := me.appended.wait()
+		results, err := storage.ReadAllFrom(me.storage, from)
+		if err != nil {
+			return err
+		}
+		for _, storedEvent := range results {
+			position := from
+			from++
+			if !filter.matches(storedEvent) {
+				continue
+			}
+			event, err := me.serializer.Deserialize(storedEvent.Data, storedEvent.TypeId)
+			if err != nil {
+				return err
+			}
+			metadata, err := me.serializer.Deserialize(storedEvent.Metadata, storedEvent.MetadataTypeId)
+			if err != nil {
+				return err
+			}
+			err = fn(position, &data.Event{
+				AggregateId: storedEvent.StreamId,
+				CreationTime: storedEvent.CreationTime,
+				Payload: event,
+				Metadata: metadata})
+			if err != nil {
+				return err
+			}
+		}
+		if len(results) > 0 {
+			continue
+		}
+		select {
+		case <-changed:
+		case <-done:
+			return nil
+		}
+	}
+}
\ No newline at end of file
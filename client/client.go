@@ -0,0 +1,323 @@
+// Package client talks to a goes server over its ZeroMQ protocol.
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/pebbe/zmq4"
+	"github.com/satori/go.uuid"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// NO_EXPECTEDVERSION appends to a stream whatever its version.
+const NO_EXPECTEDVERSION = uint32(0xFFFFFFFF)
+
+// Event is an event as the server stores it: a type and data, with optional
+// typed metadata. Types can't contain spaces.
+type Event struct {
+	TypeId         string
+	Data           []byte
+	MetadataTypeId string
+	Metadata       []byte
+}
+
+// WrongExpectedVersionError is returned when an append expected the stream to
+// have another number of events.
+type WrongExpectedVersionError struct {
+	Expected uint32
+	Actual   uint32
+}
+
+func (me *WrongExpectedVersionError) Error() string {
+	return fmt.Sprintf("WrongExpectedVersion: expected %v got %v", me.Expected, me.Actual)
+}
+
+// ServerError is any other error the server replied with.
+type ServerError struct {
+	Message string
+}
+
+func (me *ServerError) Error() string {
+	return "Server error: " + me.Message
+}
+
+// ProtocolError is returned when a reply doesn't follow the protocol.
+type ProtocolError struct {
+	Reason string
+}
+
+func (me *ProtocolError) Error() string {
+	return "Protocol error: " + me.Reason
+}
+
+// ServerInfo describes a server, as replied to Hello.
+type ServerInfo struct {
+	ServerVersion    string   `json:"serverVersion"`
+	ProtocolVersions []int    `json:"protocolVersions"`
+	ProtocolVersion  int      `json:"protocolVersion"`
+	Storage          string   `json:"storage"`
+	Commands         []string `json:"commands"`
+	Features         []string `json:"features"`
+}
+
+// HasFeature tells whether the server supports an optional feature, e.g.
+// "backup".
+func (me *ServerInfo) HasFeature(feature string) bool {
+	for _, supported := range me.Features {
+		if supported == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// PROTOCOL_VERSION is the version of the protocol the client speaks.
+const PROTOCOL_VERSION = 2
+
+// ErrTimeout is returned when the server doesn't reply within the timeout.
+var ErrTimeout = errors.New("Timeout waiting for the server reply")
+
+// Client sends one request at a time to a server. It is safe for concurrent
+// use, requests are then serialized.
+type Client struct {
+	addr    string
+	curve   *curveKeys
+	context *zmq4.Context
+	socket  *zmq4.Socket
+	timeout time.Duration
+	lock    sync.Mutex
+}
+
+type curveKeys struct {
+	serverPublicKey string
+	publicKey       string
+	secretKey       string
+}
+
+// Connect returns a client of the server at addr, e.g.
+// "tcp://127.0.0.1:12345". It waits for replies without timeout.
+func Connect(addr string) (*Client, error) {
+	return connect(addr, nil)
+}
+
+// ConnectCurve returns a client of a server secured with CURVE, given the
+// public key of the server and the key pair of the client, Z85 encoded as
+// written by `goes keygen`. A server that doesn't accept the client key never
+// replies, so set a timeout.
+func ConnectCurve(addr string, serverPublicKey string, publicKey string, secretKey string) (*Client, error) {
+	return connect(addr, &curveKeys{serverPublicKey, publicKey, secretKey})
+}
+
+func connect(addr string, curve *curveKeys) (*Client, error) {
+	context, err := zmq4.NewContext()
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{addr: addr, curve: curve, context: context, timeout: -1}
+	if err = client.open(); err != nil {
+		context.Term()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (me *Client) open() error {
+	socket, err := me.context.NewSocket(zmq4.REQ)
+	if err != nil {
+		return err
+	}
+	if err = socket.SetLinger(0); err != nil {
+		socket.Close()
+		return err
+	}
+	if err = socket.SetRcvtimeo(me.timeout); err != nil {
+		socket.Close()
+		return err
+	}
+	if me.curve != nil {
+		if err = socket.ClientAuthCurve(me.curve.serverPublicKey, me.curve.publicKey, me.curve.secretKey); err != nil {
+			socket.Close()
+			return err
+		}
+	}
+	if err = socket.Connect(me.addr); err != nil {
+		socket.Close()
+		return err
+	}
+	me.socket = socket
+	return nil
+}
+
+// SetTimeout sets how long requests wait for a reply, negative to wait
+// forever. A request timing out returns ErrTimeout and reconnects, since a
+// ZeroMQ REQ socket can't send again before it gets a reply.
+func (me *Client) SetTimeout(timeout time.Duration) error {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	me.timeout = timeout
+	return me.socket.SetRcvtimeo(timeout)
+}
+
+func (me *Client) Close() error {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	me.socket.Close()
+	return me.context.Term()
+}
+
+// request sends the frames of a command and returns the frames of the reply,
+// or the error it holds.
+func (me *Client) request(frames ...interface{}) ([][]byte, error) {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	if _, err := me.socket.SendMessage(frames...); err != nil {
+		return nil, err
+	}
+	reply, err := me.socket.RecvMessageBytes(0)
+	if err != nil {
+		me.socket.Close()
+		if openErr := me.open(); openErr != nil {
+			return nil, openErr
+		}
+		if err == zmq4.Errno(syscall.EAGAIN) {
+			return nil, ErrTimeout
+		}
+		return nil, err
+	}
+	if len(reply) == 0 {
+		return nil, &ProtocolError{"empty reply"}
+	}
+	if message := string(reply[0]); strings.HasPrefix(message, "Error: ") {
+		return nil, parseError(strings.TrimPrefix(message, "Error: "))
+	}
+	return reply, nil
+}
+
+func parseError(message string) error {
+	var expected, actual uint32
+	if _, err := fmt.Sscanf(message, "WrongExpectedVersion: expected %d got %d", &expected, &actual); err == nil {
+		return &WrongExpectedVersionError{expected, actual}
+	}
+	return &ServerError{message}
+}
+
+func passthru(typeId string, data []byte) ([]byte, error) {
+	if typeId == "" || strings.Contains(typeId, " ") {
+		return nil, errors.New("Types must be set and can't contain spaces.")
+	}
+	return append([]byte(typeId+" "), data...), nil
+}
+
+// Hello checks that the server speaks the protocol of the client and returns
+// what the server supports.
+func (me *Client) Hello() (*ServerInfo, error) {
+	reply, err := me.request("Hello", strconv.Itoa(PROTOCOL_VERSION))
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) != 2 || string(reply[0]) != "Ok" {
+		return nil, &ProtocolError{fmt.Sprintf("unexpected reply %q", reply)}
+	}
+	info := &ServerInfo{}
+	if err = json.Unmarshal(reply[1], info); err != nil {
+		return nil, &ProtocolError{"wrong server info: " + err.Error()}
+	}
+	return info, nil
+}
+
+// Ping checks that the server answers, e.g. for health checks.
+func (me *Client) Ping() error {
+	reply, err := me.request("Ping")
+	if err != nil {
+		return err
+	}
+	if len(reply) != 1 || string(reply[0]) != "Ok" {
+		return &ProtocolError{fmt.Sprintf("unexpected reply %q", reply)}
+	}
+	return nil
+}
+
+// AppendToStream appends event to a stream, which must have expectedVersion
+// events unless it is NO_EXPECTEDVERSION.
+func (me *Client) AppendToStream(streamId uuid.UUID, expectedVersion uint32, event *Event) error {
+	payload, err := passthru(event.TypeId, event.Data)
+	if err != nil {
+		return err
+	}
+	metadata := []byte{}
+	if event.MetadataTypeId != "" || len(event.Metadata) > 0 {
+		if metadata, err = passthru(event.MetadataTypeId, event.Metadata); err != nil {
+			return err
+		}
+	}
+
+	args := make([]byte, 16+4)
+	copy(args, streamId.Bytes())
+	binary.LittleEndian.PutUint32(args[16:], expectedVersion)
+	reply, err := me.request("AddEvent_v2", args, payload, metadata)
+	if err != nil {
+		return err
+	}
+	if len(reply) != 1 || string(reply[0]) != "Ok" {
+		return &ProtocolError{fmt.Sprintf("unexpected reply %q", reply)}
+	}
+	return nil
+}
+
+// ReadStream returns the events of a stream in order, none if it doesn't
+// exist.
+func (me *Client) ReadStream(streamId uuid.UUID) ([]*Event, error) {
+	reply, err := me.request("ReadStream_v2", streamId.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return readEvents(reply)
+}
+
+// ReadAll returns all events in global order.
+func (me *Client) ReadAll() ([]*Event, error) {
+	reply, err := me.request("ReadAll_v2")
+	if err != nil {
+		return nil, err
+	}
+	return readEvents(reply)
+}
+
+// readEvents parses a count frame followed by a payload and a metadata frame
+// per event.
+func readEvents(reply [][]byte) ([]*Event, error) {
+	count, err := strconv.Atoi(string(reply[0]))
+	if err != nil || count < 0 {
+		return nil, &ProtocolError{fmt.Sprintf("wrong event count %q", reply[0])}
+	}
+	if len(reply) != 1+2*count {
+		return nil, &ProtocolError{fmt.Sprintf("%v frames for %v events", len(reply), count)}
+	}
+
+	events := make([]*Event, 0, count)
+	for i := 1; i < len(reply); i += 2 {
+		event := &Event{}
+		sep := bytes.IndexByte(reply[i], ' ')
+		if sep == -1 {
+			return nil, &ProtocolError{fmt.Sprintf("payload of event %v has no type", len(events))}
+		}
+		event.TypeId, event.Data = string(reply[i][:sep]), reply[i][sep+1:]
+		if len(reply[i+1]) > 0 {
+			sep = bytes.IndexByte(reply[i+1], ' ')
+			if sep == -1 {
+				return nil, &ProtocolError{fmt.Sprintf("metadata of event %v has no type", len(events))}
+			}
+			event.MetadataTypeId, event.Metadata = string(reply[i+1][:sep]), reply[i+1][sep+1:]
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
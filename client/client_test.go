@@ -0,0 +1,181 @@
+package client
+
+import (
+	actions "../actions"
+	serializer "../serializer"
+	server "../server"
+	zmqtransport "../server/zmqtransport"
+	storage "../storage"
+	"bytes"
+	"github.com/pebbe/zmq4"
+	"github.com/satori/go.uuid"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testAddr = "tcp://127.0.0.1:23456"
+
+var startServer sync.Once
+
+func newTestClient(t *testing.T) *Client {
+	startServer.Do(func() {
+		transport, err := zmqtransport.NewZeroMQTransport(testAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := actions.NewActionsHandler(storage.NewInMemoryStorage(), serializer.NewPassthruSerializer())
+		go server.NewServer(handler).Run(transport)
+	})
+	client, err := Connect(testAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func assertEvent(t *testing.T, actual *Event, expected *Event) {
+	if actual.TypeId != expected.TypeId || !bytes.Equal(actual.Data, expected.Data) ||
+		actual.MetadataTypeId != expected.MetadataTypeId || !bytes.Equal(actual.Metadata, expected.Metadata) {
+		t.Errorf("Got event %+v, expected %+v", actual, expected)
+	}
+}
+
+func TestAppendToStreamAndReadStream(t *testing.T) {
+	//Arrange
+	client := newTestClient(t)
+	defer client.Close()
+	streamId := uuid.NewV4()
+	first := &Event{TypeId: "AnEvent", Data: []byte(`{"A":1}`), MetadataTypeId: "Metadata", Metadata: []byte(`{"user":"me"}`)}
+	second := &Event{TypeId: "AnEvent", Data: []byte{0, 1, 2}}
+
+	//Act
+	firstErr := client.AppendToStream(streamId, 0, first)
+	secondErr := client.AppendToStream(streamId, 1, second)
+	events, readErr := client.ReadStream(streamId)
+
+	//Assert
+	if firstErr != nil || secondErr != nil || readErr != nil {
+		t.Fatal(firstErr, secondErr, readErr)
+	}
+	if len(events) != 2 {
+		t.Fatalf("ReadStream got %v events, expected 2", len(events))
+	}
+	assertEvent(t, events[0], first)
+	assertEvent(t, events[1], second)
+}
+
+func TestReadAllIncludesAppendedEvents(t *testing.T) {
+	//Arrange
+	client := newTestClient(t)
+	defer client.Close()
+	event := &Event{TypeId: "ReadAllEvent", Data: []byte(uuid.NewV4().String())}
+
+	//Act
+	err := client.AppendToStream(uuid.NewV4(), NO_EXPECTEDVERSION, event)
+	events, readErr := client.ReadAll()
+
+	//Assert
+	if err != nil || readErr != nil {
+		t.Fatal(err, readErr)
+	}
+	assertEvent(t, events[len(events)-1], event)
+}
+
+func TestReadStreamOfUnknownStreamIsEmpty(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+
+	events, err := client.ReadStream(uuid.NewV4())
+
+	if err != nil || len(events) != 0 {
+		t.Errorf("ReadStream got %v events and error %v", len(events), err)
+	}
+}
+
+func TestAppendWithWrongExpectedVersionFails(t *testing.T) {
+	//Arrange
+	client := newTestClient(t)
+	defer client.Close()
+	streamId := uuid.NewV4()
+	client.AppendToStream(streamId, NO_EXPECTEDVERSION, &Event{TypeId: "AnEvent"})
+
+	//Act
+	err := client.AppendToStream(streamId, 3, &Event{TypeId: "AnEvent"})
+	_, isServerError := client.AppendToStream(streamId, NO_EXPECTEDVERSION, &Event{TypeId: "$Reserved"}).(*ServerError)
+
+	//Assert
+	wrongVersion, ok := err.(*WrongExpectedVersionError)
+	if !ok || wrongVersion.Expected != 3 || wrongVersion.Actual != 1 {
+		t.Errorf("Append with a wrong expected version failed with %#v", err)
+	}
+	if !isServerError {
+		t.Errorf("Append of a reserved type didn't fail with a ServerError")
+	}
+}
+
+func TestAppendChecksTypes(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+
+	err := client.AppendToStream(uuid.NewV4(), NO_EXPECTEDVERSION, &Event{TypeId: "Has space"})
+
+	if err == nil {
+		t.Errorf("Append of a type with a space succeeded")
+	}
+}
+
+func TestHelloNegotiatesTheProtocolVersion(t *testing.T) {
+	client := newTestClient(t)
+	defer client.Close()
+
+	info, err := client.Hello()
+	pingErr := client.Ping()
+
+	if err != nil || pingErr != nil {
+		t.Fatal(err, pingErr)
+	}
+	if info.ProtocolVersion != PROTOCOL_VERSION {
+		t.Errorf("Hello negotiated protocol version %v, expected %v", info.ProtocolVersion, PROTOCOL_VERSION)
+	}
+}
+
+func TestCurveServerAcceptsAllowedClientsAsTheirKey(t *testing.T) {
+	//Arrange
+	serverPublic, serverSecret, _ := zmq4.NewCurveKeypair()
+	allowedPublic, allowedSecret, _ := zmq4.NewCurveKeypair()
+	otherPublic, otherSecret, _ := zmq4.NewCurveKeypair()
+	curve := &zmqtransport.CurveConfig{SecretKey: serverSecret, AllowedClients: []string{allowedPublic}}
+	transport, err := zmqtransport.NewCurveZeroMQTransport("tcp://127.0.0.1:23459", curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := actions.NewActionsHandler(storage.NewInMemoryStorage(), serializer.NewPassthruSerializer())
+	acl, _ := actions.NewACL([]actions.AclRule{{Principals: []string{allowedPublic}, Operations: []string{actions.WRITE}}})
+	handler.SetACL(acl)
+	srv := server.NewServer(handler)
+	go srv.Run(transport)
+	defer srv.Shutdown()
+	allowed, _ := ConnectCurve("tcp://127.0.0.1:23459", serverPublic, allowedPublic, allowedSecret)
+	defer allowed.Close()
+	other, _ := ConnectCurve("tcp://127.0.0.1:23459", serverPublic, otherPublic, otherSecret)
+	defer other.Close()
+	other.SetTimeout(200 * time.Millisecond)
+
+	//Act
+	allowedErr := allowed.Ping()
+	appendErr := allowed.AppendToStream(uuid.NewV4(), NO_EXPECTEDVERSION, &Event{TypeId: "AnEvent"})
+	_, readErr := allowed.ReadAll()
+	otherErr := other.Ping()
+
+	//Assert
+	if allowedErr != nil || appendErr != nil {
+		t.Errorf("Allowed client failed with %v and %v", allowedErr, appendErr)
+	}
+	if _, ok := readErr.(*ServerError); !ok {
+		t.Errorf("ReadAll, which the ACL doesn't grant, failed with %v", readErr)
+	}
+	if otherErr != ErrTimeout {
+		t.Errorf("Other client got %v", otherErr)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	storage "./storage"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// stdout is where `goes backup -` streams the backup: main sends everything
+// else printed to stderr then, so the stream isn't mixed with messages.
+var stdout io.Writer = os.Stdout
+
+// runCommand runs one of the commands given after the flags, e.g.
+// `goes --db=./events backup ./backup`, against the opened storage.
+func runCommand(diskStorage storage.Storage, command string, args []string) error {
+	switch command {
+	case "backup":
+		return backup(diskStorage, args)
+	case "import":
+		return importEvents(diskStorage, args)
+	case "export":
+		return exportEvents(diskStorage, args)
+	}
+	return errors.New("Unknown command: " + command)
+}
+
+// backup backs the storage up to a directory or a .tar file, or streams it as
+// tar to stdout when the target is "-".
+func backup(diskStorage storage.Storage, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Usage: goes [flags] backup <directory, .tar file or - for stdout>")
+	}
+	if args[0] == "-" {
+		position, err := storage.BackupToTarget(diskStorage, storage.NewTarBackupTarget(stdout))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Backed up", position, "events to stdout")
+		return nil
+	}
+	position, err := storage.BackupTo(diskStorage, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println("Backed up", position, "events to", args[0])
+	return nil
+}
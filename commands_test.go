@@ -0,0 +1,85 @@
+package main
+
+import (
+	storage "./storage"
+	"archive/tar"
+	"bytes"
+	"github.com/satori/go.uuid"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBackupToDashStreamsATarToStdout(t *testing.T) {
+	//Arrange
+	sourcePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(sourcePath)
+	source := storage.NewDailyDiskStorage(sourcePath)
+	defer storage.Close(source)
+	for i := 0; i < 3; i++ {
+		source.Write(&storage.StoredEvent{StreamId: uuid.NewV4(), CreationTime: time.Now(), TypeId: "AnEvent", Data: []byte("{}"), MetadataTypeId: "Metadata", Metadata: []byte("{}")})
+	}
+	var stream bytes.Buffer
+	stdout = &stream
+	defer func() { stdout = os.Stdout }()
+
+	//Act
+	err := backup(source, []string{"-"})
+
+	//Assert
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	reader := tar.NewReader(&stream)
+	names := make(map[string]bool)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Backup isn't a tar stream: %v", err)
+		}
+		names[header.Name] = true
+	}
+	if !names["format"] {
+		t.Errorf("Backup stream lacks the format file, it holds %v", names)
+	}
+}
+
+func TestExportAndBackupOpenADailyStoreReadOnly(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	source := storage.NewDailyDiskStorage(storagePath)
+	for i := 0; i < 3; i++ {
+		source.Write(&storage.StoredEvent{StreamId: uuid.NewV4(), CreationTime: time.Now(), TypeId: "AnEvent", Data: []byte("{}"), MetadataTypeId: "Metadata", Metadata: []byte("{}")})
+	}
+	storage.Close(source)
+	before := snapshotFiles(t, storagePath)
+
+	for _, command := range []string{"export", "backup"} {
+		//Act
+		opened, err := openStorage("daily", storagePath, command)
+		if err != nil {
+			t.Fatalf("Opening the store for %s failed: %v", command, err)
+		}
+		count, countErr := storage.EventCount(opened)
+		writeErr := opened.Write(&storage.StoredEvent{StreamId: uuid.NewV4(), CreationTime: time.Now(), TypeId: "AnEvent", Data: []byte("{}")})
+		storage.Close(opened)
+
+		//Assert
+		if countErr != nil || count != 3 {
+			t.Errorf("The store opened for %s has %v events, error %v, expected 3", command, count, countErr)
+		}
+		if writeErr == nil {
+			t.Errorf("The store opened for %s accepted a write", command)
+		}
+		if after := snapshotFiles(t, storagePath); !reflect.DeepEqual(after, before) {
+			t.Errorf("Opening the store for %s modified it. Files before: %v, after: %v", command, before, after)
+		}
+	}
+}
@@ -6,6 +6,13 @@ import (
 	"time"
 )
 
+// STREAM_DELETED_TYPE is the type of the tombstone ending a deleted stream.
+const STREAM_DELETED_TYPE = "$StreamDeleted"
+
+// StreamDeleted is the payload of a tombstone as deserialized by the
+// JsonSerializer.
+type StreamDeleted struct{}
+
 type Event struct {
 	AggregateId 	uuid.UUID
 	CreationTime 	time.Time
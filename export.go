@@ -0,0 +1,151 @@
+package main
+
+import (
+	storage "./storage"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{"streamId", "version", "position", "typeId", "creationTime", "payload", "metadataTypeId", "metadata"}
+
+// exportEvents writes the events of diskStorage from a global position on,
+// optionally of a single type, to a JSON Lines or CSV file. Each record holds
+// the version of the event in its stream and its global position.
+func exportEvents(diskStorage storage.Storage, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "jsonl", "output format: jsonl or csv")
+	from := flags.Uint64("from", 0, "global position of the first event to export")
+	typeId := flags.String("type", "", "only export events of this type")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("Usage: goes [flags] export [--format=jsonl|csv] [--from=<position>] [--type=<typeId>] <file>")
+	}
+
+	var newWriter func(io.Writer) recordWriter
+	switch *format {
+	case "jsonl":
+		newWriter = newJsonLinesWriter
+	case "csv":
+		newWriter = newCsvWriter
+	default:
+		return errors.New(fmt.Sprintf("Unknown format %q, expected jsonl or csv.", *format))
+	}
+
+	file, err := os.OpenFile(flags.Arg(0), os.O_EXCL|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	count, err := writeRecords(newWriter(file), diskStorage, *from, *typeId)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// A partial export isn't left behind.
+		os.Remove(flags.Arg(0))
+		return err
+	}
+	fmt.Println("Exported", count, "events to", flags.Arg(0))
+	return nil
+}
+
+func writeRecords(writer recordWriter, diskStorage storage.Storage, from uint64, typeId string) (int, error) {
+	events, err := diskStorage.ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	versions := make(map[string]uint32)
+	count := 0
+	for position, event := range events {
+		streamId := event.StreamId.String()
+		versions[streamId]++
+		if uint64(position) < from || (typeId != "" && event.TypeId != typeId) {
+			continue
+		}
+		record := &eventRecord{
+			StreamId:       streamId,
+			Version:        versions[streamId],
+			Position:       uint64(position),
+			TypeId:         event.TypeId,
+			CreationTime:   event.CreationTime,
+			Payload:        event.Data,
+			MetadataTypeId: event.MetadataTypeId,
+			Metadata:       event.Metadata}
+		if err = writer.write(record); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, writer.flush()
+}
+
+type recordWriter interface {
+	write(record *eventRecord) error
+	flush() error
+}
+
+type jsonLinesWriter struct {
+	encoder *json.Encoder
+}
+
+func newJsonLinesWriter(w io.Writer) recordWriter {
+	return &jsonLinesWriter{json.NewEncoder(w)}
+}
+
+func (me *jsonLinesWriter) write(record *eventRecord) error {
+	return me.encoder.Encode(record)
+}
+
+func (me *jsonLinesWriter) flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+func newCsvWriter(w io.Writer) recordWriter {
+	return &csvWriter{csv.NewWriter(w), false}
+}
+
+// write encodes payload and metadata in base64 like JSON Lines do.
+func (me *csvWriter) write(record *eventRecord) error {
+	if !me.header {
+		if err := me.writer.Write(csvHeader); err != nil {
+			return err
+		}
+		me.header = true
+	}
+	return me.writer.Write([]string{
+		record.StreamId,
+		strconv.FormatUint(uint64(record.Version), 10),
+		strconv.FormatUint(record.Position, 10),
+		record.TypeId,
+		record.CreationTime.Format(time.RFC3339Nano),
+		base64.StdEncoding.EncodeToString(record.Payload),
+		record.MetadataTypeId,
+		base64.StdEncoding.EncodeToString(record.Metadata)})
+}
+
+func (me *csvWriter) flush() error {
+	if !me.header {
+		if err := me.writer.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	me.writer.Flush()
+	return me.writer.Error()
+}
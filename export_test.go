@@ -0,0 +1,133 @@
+package main
+
+import (
+	storage "./storage"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/satori/go.uuid"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeExportTestEvents(t *testing.T) []uuid.UUID {
+	streams := []uuid.UUID{uuid.NewV4(), uuid.NewV4()}
+	for i := 0; i < 6; i++ {
+		err := _storage.Write(&storage.StoredEvent{
+			StreamId:       streams[i%2],
+			CreationTime:   time.Date(2016, 2, 11, 9, 53, i, 0, time.UTC),
+			TypeId:         []string{"AnEvent", "AnotherEvent", "AnEvent"}[i%3],
+			Data:           []byte{byte(i)},
+			MetadataTypeId: "Metadata",
+			Metadata:       []byte("{}")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return streams
+}
+
+func TestExportJsonLines(t *testing.T) {
+	setUpWith(backends["InMemoryStorage"])
+	defer tearDown()
+	streams := writeExportTestEvents(t)
+	os.MkdirAll(tempDir, 0777)
+	filename := path.Join(tempDir, "events.jsonl")
+
+	err := exportEvents(_storage, []string{"--from=1", "--type=AnEvent", filename})
+
+	if err != nil {
+		t.Fatalf("Export failed. Error: %v", err)
+	}
+	file, _ := os.Open(filename)
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	records := make([]eventRecord, 0)
+	for decoder.More() {
+		var record eventRecord
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Export failed. Got %v records, expected %v", len(records), 3)
+	}
+	record := records[1]
+	if record.StreamId != streams[1].String() || record.Version != 2 || record.Position != 3 || record.TypeId != "AnEvent" || record.Payload[0] != 3 {
+		t.Errorf("Export failed. Got %+v", record)
+	}
+}
+
+func TestExportCsv(t *testing.T) {
+	setUpWith(backends["InMemoryStorage"])
+	defer tearDown()
+	streams := writeExportTestEvents(t)
+	os.MkdirAll(tempDir, 0777)
+	filename := path.Join(tempDir, "events.csv")
+
+	err := exportEvents(_storage, []string{"--format=csv", filename})
+
+	if err != nil {
+		t.Fatalf("Export failed. Error: %v", err)
+	}
+	file, _ := os.Open(filename)
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil || len(rows) != 7 {
+		t.Fatalf("Export failed. Got %v rows and error %v, expected %v rows", len(rows), err, 7)
+	}
+	if strings.Join(rows[0], ",") != strings.Join(csvHeader, ",") {
+		t.Errorf("Export failed. Got header %v", rows[0])
+	}
+	expected := []string{streams[0].String(), "3", "4", "AnotherEvent", "2016-02-11T09:53:04Z", "BA==", "Metadata", "e30="}
+	if strings.Join(rows[5], ",") != strings.Join(expected, ",") {
+		t.Errorf("Export failed. Got row %v, expected %v", rows[5], expected)
+	}
+}
+
+func TestExportThenImport(t *testing.T) {
+	setUpWith(backends["InMemoryStorage"])
+	defer tearDown()
+	writeExportTestEvents(t)
+	os.MkdirAll(tempDir, 0777)
+	filename := path.Join(tempDir, "events.jsonl")
+	exported, _ := _storage.ReadAll()
+
+	err := exportEvents(_storage, []string{filename})
+	target := storage.NewInMemoryStorage()
+	importErr := importEvents(target, []string{filename})
+
+	if err != nil || importErr != nil {
+		t.Fatalf("Export then import failed. Errors: %v, %v", err, importErr)
+	}
+	imported, _ := target.ReadAll()
+	assertImported(t, imported, exported)
+}
+
+type failingReadStorage struct {
+	storage.Storage
+}
+
+func (me failingReadStorage) ReadAll() ([]*storage.StoredEvent, error) {
+	return nil, errors.New("Integrity error.")
+}
+
+func TestFailedExportRemovesTheFile(t *testing.T) {
+	setUpWith(backends["InMemoryStorage"])
+	defer tearDown()
+	os.MkdirAll(tempDir, 0777)
+	filename := path.Join(tempDir, "events.jsonl")
+
+	err := exportEvents(failingReadStorage{_storage}, []string{filename})
+
+	if err == nil || err.Error() != "Integrity error." {
+		t.Errorf("Export failed with %v, expected the read error", err)
+	}
+	if _, statErr := os.Stat(filename); !os.IsNotExist(statErr) {
+		t.Errorf("Export left the file of the failed export. Error: %v", statErr)
+	}
+}
@@ -4,16 +4,37 @@ import (
 	actions "./actions"
 	serializer "./serializer"
 	server "./server"
+	grpctransport "./server/grpctransport"
+	zmqtransport "./server/zmqtransport"
 	storage "./storage"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path"
+	"strings"
+	"syscall"
 )
 
-var addr = flag.String("addr", "tcp://127.0.0.1:12345", "zeromq address to listen to")
+var addr = flag.String("addr", "tcp://127.0.0.1:12345", "zeromq addresses to listen to, separated by commas")
+var httpAddr = flag.String("http", "", "address to serve the HTTP API on, e.g. :8080 (disabled by default)")
+var grpcAddr = flag.String("grpc", "", "address to serve the gRPC service on, e.g. :9090 (disabled by default)")
 var db = flag.String("db", fmt.Sprintf(".%cevents", os.PathSeparator), "path for storage")
 var buildTypeIndexes = flag.Bool("buildTypeIndexes", false, "Build type indexes")
+var storageType = flag.String("storage", "daily", "storage backend: daily, simple, chunk, bolt or memory")
+var durability = flag.String("durability", "none", "when writes are flushed to disk: none, fsync (every write, recommended) or group (every batch of writes)")
+var migrate = flag.Bool("migrate", false, "Migrate storage to the current format")
+var rebuildIndexes = flag.Bool("rebuildIndexes", false, "Rebuild all indexes of a daily storage from its event files")
+var curveKey = flag.String("curveKey", "", "secret key file of the server, from goes keygen, to secure the zeromq addresses with CURVE")
+var curveClients = flag.String("curveClients", "", "file of the public keys of the clients allowed with --curveKey, one per line (any client by default)")
+var aclFile = flag.String("acl", "", "JSON file of the ACL rules granting operations to principals (all operations are allowed by default)")
+var backupDir = flag.String("backupDir", "", "directory the targets of the Backup command are relative to (Backup is refused by default)")
+var verify = flag.Bool("verify", false, "Verify the integrity of a daily storage without modifying it")
+
+// version is reported to clients by the Hello command. Release builds set it
+// with -ldflags "-X main.version=1.2.3".
+var version = "dev"
 
 func PathIsAbsolute(s string) bool {
 	if len(s) > 1 && s[1] == ':' {
@@ -22,12 +43,51 @@ func PathIsAbsolute(s string) bool {
 	return path.IsAbs(s)
 }
 
+func newStorage(storageType string, storagePath string) storage.Storage {
+	switch storageType {
+	case "daily":
+		return storage.NewDailyDiskStorage(storagePath)
+	case "simple":
+		return storage.NewSimpleDiskStorage(storagePath)
+	case "chunk":
+		return storage.NewChunkDiskStorage(storagePath)
+	case "bolt":
+		return storage.NewBoltStorage(storagePath)
+	case "memory":
+		return storage.NewInMemoryStorage()
+	}
+	fmt.Println("Unknown storage:", storageType)
+	os.Exit(1)
+	return nil
+}
+
+// openStorage opens the storage for command, if any. The export and backup
+// commands only read a daily store, which they open read-only: it isn't
+// recovered, so exporting or backing it up leaves it as it is.
+func openStorage(storageType string, storagePath string, command string) (storage.Storage, error) {
+	if storageType == "daily" && (command == "export" || command == "backup") {
+		return storage.OpenDailyDiskStorageReadOnly(storagePath)
+	}
+	return newStorage(storageType, storagePath), nil
+}
+
 func main() {
+	flag.Parse()
+	if flag.Arg(0) == "backup" && flag.Arg(1) == "-" {
+		os.Stdout = os.Stderr
+	}
+
 	fmt.Println("GoES - Go Event Store")
 	fmt.Println("Released under the MIT license. See LICENSE file.")
 	fmt.Println()
 
-	flag.Parse()
+	if flag.Arg(0) == "keygen" {
+		if err := keygen(flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	storagePath := *db
 	if !PathIsAbsolute(storagePath) {
@@ -35,14 +95,201 @@ func main() {
 		storagePath = path.Join(wd, storagePath)
 	}
 
-	diskStorage := storage.NewDailyDiskStorage(storagePath)
-	if *buildTypeIndexes {
-		diskStorage.RebuildTypeIndexes()
+	if *migrate {
+		if err := storage.MigrateDailyDiskStorage(storagePath); err != nil {
+			fmt.Println("Migration failed:", err)
+			os.Exit(1)
+		}
 		return
 	}
 
+	if *rebuildIndexes {
+		if err := storage.RebuildDailyDiskIndexes(storagePath); err != nil {
+			fmt.Println("Rebuild failed:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *verify {
+		if *storageType != "daily" {
+			fmt.Println("Verify only supports daily storage.")
+			os.Exit(1)
+		}
+		problems, err := storage.VerifyDailyDiskStorage(storagePath, os.Stdout)
+		if err != nil {
+			fmt.Println("Verify failed:", err)
+			os.Exit(1)
+		}
+		if problems > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	diskStorage, err := openStorage(*storageType, storagePath, flag.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	features := make([]string, 0)
+	if _, ok := diskStorage.(storage.BackupStorage); ok && *backupDir != "" {
+		features = append(features, "backup")
+	}
+	if durableStorage, ok := diskStorage.(storage.DurableStorage); ok {
+		mode, err := storage.ParseDurability(*durability)
+		if err != nil {
+			fmt.Println(err)
+			closeAndExit(diskStorage, 1)
+		}
+		durableStorage.SetDurability(mode)
+		features = append(features, "durability:"+*durability)
+		if mode == storage.DURABILITY_GROUP {
+			diskStorage = storage.NewGroupCommitStorage(diskStorage)
+		}
+	}
+	if *buildTypeIndexes {
+		if err := diskStorage.RebuildTypeIndexes(); err != nil {
+			fmt.Println("Rebuilding type indexes failed:", err)
+			closeAndExit(diskStorage, 1)
+		}
+		closeAndExit(diskStorage, 0)
+	}
+
+	if flag.NArg() > 0 {
+		if err := runCommand(diskStorage, flag.Arg(0), flag.Args()[1:]); err != nil {
+			fmt.Println(err)
+			closeAndExit(diskStorage, 1)
+		}
+		closeAndExit(diskStorage, 0)
+	}
+
 	var handler = actions.NewActionsHandler(diskStorage, serializer.NewPassthruSerializer())
-	server.Bind(*addr)
-	server.Listen(handler)
-	server.Destroy()
+	if *aclFile != "" {
+		acl, err := actions.ReadACLFile(*aclFile)
+		if err != nil {
+			fmt.Println(err)
+			closeAndExit(diskStorage, 1)
+		}
+		handler.SetACL(acl)
+		features = append(features, "acl")
+	}
+	transports, err := newTransports()
+	if err != nil {
+		fmt.Println(err)
+		closeAndExit(diskStorage, 1)
+	}
+	if *curveKey != "" {
+		features = append(features, "curve")
+	}
+	if *httpAddr != "" {
+		features = append(features, "http")
+	}
+	if *grpcAddr != "" {
+		features = append(features, "grpc")
+	}
+	srv := server.NewServer(handler)
+	srv.Info.ServerVersion = version
+	srv.Info.Storage = *storageType
+	srv.Info.Features = features
+	srv.BackupDir = *backupDir
+	go shutdownOnSignal(srv)
+	err = srv.Run(transports...)
+	if closeErr := storage.Close(diskStorage); closeErr != nil {
+		fmt.Println("Closing storage failed:", closeErr)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Println("Server failed:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Server stopped.")
+}
+
+// closeAndExit closes the storage, flushing what it buffers, then exits with
+// code, or with 1 if closing fails.
+func closeAndExit(diskStorage storage.Storage, code int) {
+	if err := storage.Close(diskStorage); err != nil {
+		fmt.Println("Closing storage failed:", err)
+		code = 1
+	}
+	os.Exit(code)
+}
+
+// shutdownOnSignal shuts the server down on SIGINT or SIGTERM: Run returns
+// once the requests in progress, such as a backup, are answered and the
+// background rebuild is done, then main closes the storage. A second signal
+// exits at once.
+func shutdownOnSignal(srv *server.Server) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	received := <-signals
+	fmt.Println("Received", received, "- shutting down, signal again to exit at once.")
+	srv.Shutdown()
+	<-signals
+	os.Exit(1)
+}
+
+// newTransports binds the ZeroMQ addresses and, when set, the HTTP and gRPC
+// ones.
+func newTransports() ([]server.Transport, error) {
+	transports := make([]server.Transport, 0)
+	curve, err := newCurveConfig()
+	if err != nil {
+		return nil, err
+	}
+	closeAll := func() {
+		for _, transport := range transports {
+			transport.Close()
+		}
+	}
+	for _, zmqAddr := range strings.Split(*addr, ",") {
+		transport, err := zmqtransport.NewCurveZeroMQTransport(zmqAddr, curve)
+		if err != nil {
+			closeAll()
+			return nil, errors.New(fmt.Sprintf("Binding %s failed: %v", zmqAddr, err))
+		}
+		transports = append(transports, transport)
+	}
+	if *httpAddr != "" {
+		transport, err := server.NewHttpTransport(*httpAddr)
+		if err != nil {
+			closeAll()
+			return nil, errors.New(fmt.Sprintf("Listening on %s failed: %v", *httpAddr, err))
+		}
+		transports = append(transports, transport)
+	}
+	if *grpcAddr != "" {
+		transport, err := grpctransport.NewGrpcTransport(*grpcAddr)
+		if err != nil {
+			closeAll()
+			return nil, errors.New(fmt.Sprintf("Listening on %s failed: %v", *grpcAddr, err))
+		}
+		transports = append(transports, transport)
+	}
+	return transports, nil
+}
+
+// newCurveConfig reads the keys given with --curveKey and --curveClients, nil
+// when the ZeroMQ addresses aren't secured.
+func newCurveConfig() (*zmqtransport.CurveConfig, error) {
+	if *curveKey == "" {
+		if *curveClients != "" {
+			return nil, errors.New("--curveClients requires --curveKey.")
+		}
+		return nil, nil
+	}
+	secretKey, err := zmqtransport.ReadKeyFile(*curveKey)
+	if err != nil {
+		return nil, err
+	}
+	curve := &zmqtransport.CurveConfig{SecretKey: secretKey}
+	if *curveClients == "" {
+		fmt.Println("Warning: --curveClients isn't set, any client knowing the server public key is accepted.")
+		return curve, nil
+	}
+	if curve.AllowedClients, err = zmqtransport.ReadKeysFile(*curveClients); err != nil {
+		return nil, err
+	}
+	return curve, nil
 }
@@ -6,10 +6,12 @@ import (
 	serializer "./serializer"
 	storage "./storage"
 	"bytes"
+	"errors"
 	"github.com/satori/go.uuid"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"testing"
 )
 
@@ -29,148 +31,228 @@ type AnotherEvent struct {
 	F float64
 }
 
-func setUp() {
+var backends = map[string]func(string) storage.Storage{
+	"InMemoryStorage":   func(string) storage.Storage { return storage.NewInMemoryStorage() },
+	"SimpleDiskStorage": storage.NewSimpleDiskStorage,
+	"DailyDiskStorage":  storage.NewDailyDiskStorage,
+	"ChunkDiskStorage":  storage.NewChunkDiskStorage,
+	"BoltStorage":       storage.NewBoltStorage,
+}
+
+// diskBackends are the backends storing events in files under tempDir.
+var diskBackends = []string{"SimpleDiskStorage", "DailyDiskStorage", "ChunkDiskStorage", "BoltStorage"}
+
+var allBackends = append([]string{"InMemoryStorage"}, diskBackends...)
+
+func setUpWith(newStorage func(string) storage.Storage) {
 	tempDir = path.Join(os.TempDir(), uuid.NewV4().String())
-	_storage = storage.NewSimpleDiskStorage(tempDir)
+	_storage = newStorage(tempDir)
 	_serializer = serializer.NewJsonSerializer((*AnEvent)(nil), (*AnotherEvent)(nil))
 	handler = actions.NewActionsHandler(_storage, _serializer)
 }
 
 func tearDown() {
+	if err := storage.Close(_storage); err != nil {
+		panic(err)
+	}
 	err := os.RemoveAll(tempDir)
 	if err != nil {
 		panic(err)
 	}
 }
 
+// forEachBackend runs test as a subtest against a new store of each backend.
+func forEachBackend(t *testing.T, names []string, test func(t *testing.T)) {
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			setUpWith(backends[name])
+			defer tearDown()
+			test(t)
+		})
+	}
+}
+
+// filesContaining returns the files under tempDir that contain content.
+func filesContaining(content []byte) []string {
+	filenames := make([]string, 0)
+	filepath.Walk(tempDir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if fileContent, err := ioutil.ReadFile(filename); err == nil && bytes.Contains(fileContent, content) {
+			filenames = append(filenames, filename)
+		}
+		return nil
+	})
+	return filenames
+}
+
 func wrapEvent(aggregateId uuid.UUID, event interface{}) data.Event {
 	return data.Event{AggregateId: aggregateId, Payload: event, Metadata: nil}
 }
 
 func TestSerializeEventToJson(t *testing.T) {
-	setUp()
-	defer tearDown()
+	forEachBackend(t, diskBackends, func(t *testing.T) {
+		ev := wrapEvent(uuid.NewV4(), AnEvent{int64(1024), "Tests"})
+		err := handler.AddEvent(ev, actions.NO_EXPECTEDVERSION)
+		if err != nil {
+			t.Errorf("AddEvent failed with %q", err)
+			return
+		}
 
-	ev := wrapEvent(uuid.NewV4(), AnEvent{int64(1024), "Tests"})
-	err := handler.AddEvent(ev, actions.NO_EXPECTEDVERSION)
-	if err != nil {
-		t.Errorf("AddEvent failed with %q", err)
-		return
-	}
-
-	filename := (_storage.(*storage.SimpleDiskStorage)).GetFilenameForEvents(ev.AggregateId.String())
-	if fi, _ := os.Stat(filename); fi == nil {
-		t.Errorf("AddEvent failed to create file %q", filename)
-		return
-	}
-	content, _ := ioutil.ReadFile(filename)
-	if !bytes.Contains(content, []byte("{\"A\":1024,\"B\":\"Tests\"}")) {
-		t.Errorf("AddEvent failed. File doesn't contain event json.")
-		return
-	}
+		if len(filesContaining([]byte("{\"A\":1024,\"B\":\"Tests\"}"))) == 0 {
+			t.Errorf("AddEvent failed. No file contains event json.")
+		}
+	})
 }
 
+// Daily disk storage keeps each event in its own file.
 func TestSerializeEventsForSameAggregateInSameFile(t *testing.T) {
-	setUp()
-	defer tearDown()
-
-	aggregateId := uuid.NewV4()
-	ev1 := wrapEvent(aggregateId, AnEvent{int64(12345), "Hello"})
-	err := handler.AddEvent(ev1, actions.NO_EXPECTEDVERSION)
-	if err != nil {
-		t.Errorf("AddEvent failed with %q", err)
-		return
-	}
-	ev2 := wrapEvent(aggregateId, AnotherEvent{int64(23456), "Bob", 123.45})
-	err = handler.AddEvent(ev2, actions.NO_EXPECTEDVERSION)
-	if err != nil {
-		t.Errorf("AddEvent failed with %q", err)
-		return
-	}
+	forEachBackend(t, []string{"SimpleDiskStorage", "ChunkDiskStorage", "BoltStorage"}, func(t *testing.T) {
+		aggregateId := uuid.NewV4()
+		ev1 := wrapEvent(aggregateId, AnEvent{int64(12345), "Hello"})
+		err := handler.AddEvent(ev1, actions.NO_EXPECTEDVERSION)
+		if err != nil {
+			t.Errorf("AddEvent failed with %q", err)
+			return
+		}
+		ev2 := wrapEvent(aggregateId, AnotherEvent{int64(23456), "Bob", 123.45})
+		err = handler.AddEvent(ev2, actions.NO_EXPECTEDVERSION)
+		if err != nil {
+			t.Errorf("AddEvent failed with %q", err)
+			return
+		}
 
-	filename := (_storage.(*storage.SimpleDiskStorage)).GetFilenameForEvents(aggregateId.String())
-	content, _ := ioutil.ReadFile(filename)
-	if !bytes.Contains(content, []byte("Hello")) || !bytes.Contains(content, []byte("Bob")) {
-		t.Error("AddEvent failed. Both events are not serialized in same file.")
-		return
-	}
+		hello, bob := filesContaining([]byte("Hello")), filesContaining([]byte("Bob"))
+		if len(hello) != 1 || len(bob) != 1 || hello[0] != bob[0] {
+			t.Errorf("AddEvent failed. Both events are not serialized in same file: %v and %v.", hello, bob)
+		}
+	})
 }
 
 func TestTypeInformationIsProvided(t *testing.T) {
-	setUp()
-	defer tearDown()
+	forEachBackend(t, diskBackends, func(t *testing.T) {
+		ev := wrapEvent(uuid.NewV4(), AnEvent{int64(1024), "Tests"})
+		err := handler.AddEvent(ev, actions.NO_EXPECTEDVERSION)
+		if err != nil {
+			t.Errorf("AddEvent failed with %q", err)
+			return
+		}
 
-	ev := wrapEvent(uuid.NewV4(), AnEvent{int64(1024), "Tests"})
-	err := handler.AddEvent(ev, actions.NO_EXPECTEDVERSION)
-	if err != nil {
-		t.Errorf("AddEvent failed with %q", err)
-		return
-	}
-
-	filename := (_storage.(*storage.SimpleDiskStorage)).GetFilenameForEvents(ev.AggregateId.String())
-	if fi, _ := os.Stat(filename); fi == nil {
-		t.Errorf("AddEvent failed to create file %q", filename)
-		return
-	}
-	content, _ := ioutil.ReadFile(filename)
-	if !bytes.Contains(content, []byte("AnEvent")) {
-		t.Errorf("AddEvent failed. File doesn't contain event type.")
-		return
-	}
+		if len(filesContaining([]byte("AnEvent"))) == 0 {
+			t.Errorf("AddEvent failed. No file contains event type.")
+		}
+	})
 }
 
 func TestEventsCanBeRetrieved(t *testing.T) {
-	setUp()
-	defer tearDown()
+	forEachBackend(t, allBackends, func(t *testing.T) {
+		aggregateId := uuid.NewV4()
+		ev1 := wrapEvent(aggregateId, AnEvent{int64(12345), "Hello"})
+		err := handler.AddEvent(ev1, actions.NO_EXPECTEDVERSION)
+		if err != nil {
+			t.Errorf("AddEvent failed with %q", err)
+			return
+		}
+		ev2 := wrapEvent(aggregateId, AnotherEvent{int64(23456), "Bob", 123.45})
+		err = handler.AddEvent(ev2, actions.NO_EXPECTEDVERSION)
+		if err != nil {
+			t.Errorf("AddEvent failed with %q", err)
+			return
+		}
 
-	aggregateId := uuid.NewV4()
-	ev1 := wrapEvent(aggregateId, AnEvent{int64(12345), "Hello"})
-	err := handler.AddEvent(ev1, actions.NO_EXPECTEDVERSION)
-	if err != nil {
-		t.Errorf("AddEvent failed with %q", err)
-		return
-	}
-	ev2 := wrapEvent(aggregateId, AnotherEvent{int64(23456), "Bob", 123.45})
-	err = handler.AddEvent(ev2, actions.NO_EXPECTEDVERSION)
-	if err != nil {
-		t.Errorf("AddEvent failed with %q", err)
-		return
-	}
-
-	events, err := handler.RetrieveFor(aggregateId)
-	switch {
-	case err != nil:
-		t.Errorf("RetrieveFor(%q) failed with %q. %q", aggregateId.String(), err, tempDir)
-	case len(events) != 2:
-		t.Errorf("RetrieveFor(%q) returned %v events, expected %v", aggregateId.String(), len(events), 2)
-	case !ev1.Equals(events[0]):
-		t.Errorf("RetrieveFor(%q) first event doesn't match %+v != %+v", aggregateId.String(), events[0], ev1)
-	case !ev2.Equals(events[1]):
-		t.Errorf("RetrieveFor(%q) second event doesn't match %+v != %+v", aggregateId.String(), events[1], ev2)
-	}
+		events, err := handler.RetrieveFor(aggregateId)
+		switch {
+		case err != nil:
+			t.Errorf("RetrieveFor(%q) failed with %q. %q", aggregateId.String(), err, tempDir)
+		case len(events) != 2:
+			t.Errorf("RetrieveFor(%q) returned %v events, expected %v", aggregateId.String(), len(events), 2)
+		case !ev1.Equals(events[0]):
+			t.Errorf("RetrieveFor(%q) first event doesn't match %+v != %+v", aggregateId.String(), events[0], ev1)
+		case !ev2.Equals(events[1]):
+			t.Errorf("RetrieveFor(%q) second event doesn't match %+v != %+v", aggregateId.String(), events[1], ev2)
+		}
+	})
 }
 
 func TestEventsCanBeReplayedInOrder(t *testing.T) {
-	setUp()
+	forEachBackend(t, allBackends, func(t *testing.T) {
+		aggregateId1 := uuid.NewV4()
+		aggregateId2 := uuid.NewV4()
+		testEvent1 := wrapEvent(aggregateId1, AnEvent{int64(123), "Hello 1"})
+		testEvent2 := wrapEvent(aggregateId2, AnEvent{int64(456), "Hello 2"})
+		testEvent3 := wrapEvent(aggregateId1, AnEvent{int64(789), "Hello 3"})
+		handler.AddEvent(testEvent1, actions.NO_EXPECTEDVERSION)
+		handler.AddEvent(testEvent2, actions.NO_EXPECTEDVERSION)
+		handler.AddEvent(testEvent3, actions.NO_EXPECTEDVERSION)
+
+		events, err := handler.RetrieveAll()
+		switch {
+		case err != nil:
+			t.Errorf("RetrieveAll failed with %q %q", err, tempDir)
+		case len(events) != 3:
+			t.Errorf("RetrieveAll returned %v events, expected %v", len(events), 3)
+		case !testEvent1.Equals(events[0]) || !testEvent2.Equals(events[1]) || !testEvent3.Equals(events[2]):
+			t.Error("RetrieveAll returned events in wrong order.")
+		}
+	})
+}
+
+func TestDeletedStreamIsReadAfterItsTombstone(t *testing.T) {
+	forEachBackend(t, allBackends, func(t *testing.T) {
+		aggregateId := uuid.NewV4()
+		ev1 := wrapEvent(aggregateId, AnEvent{int64(123), "Hello 1"})
+		ev2 := wrapEvent(aggregateId, AnEvent{int64(456), "Hello 2"})
+		ev3 := wrapEvent(aggregateId, AnEvent{int64(789), "Hello 3"})
+		handler.AddEvent(ev1, actions.NO_EXPECTEDVERSION)
+		handler.AddEvent(ev2, actions.NO_EXPECTEDVERSION)
+		if err := handler.DeleteStream(aggregateId, 2); err != nil {
+			t.Fatalf("DeleteStream failed with %q", err)
+		}
+		deleted, first, deletedErr := handler.RetrieveStreamFrom(aggregateId, 1, 10)
+		handler.AddEvent(ev3, actions.NO_EXPECTEDVERSION)
+
+		events, err := handler.RetrieveFor(aggregateId)
+		page, pageFirst, pageErr := handler.RetrieveStreamFrom(aggregateId, 2, 10)
+		version, versionErr := handler.StreamVersion(aggregateId)
+		all, allErr := handler.RetrieveAll()
+		switch {
+		case deletedErr != nil || len(deleted) != 0 || first != 4:
+			t.Errorf("RetrieveStreamFrom of a deleted stream returned %v, %v, %q, expected no events from version 4", deleted, first, deletedErr)
+		case err != nil || len(events) != 1 || !ev3.Equals(events[0]):
+			t.Errorf("RetrieveFor returned %+v, %q, expected only %+v", events, err, ev3)
+		case pageErr != nil || len(page) != 1 || !ev3.Equals(page[0]) || pageFirst != 4:
+			t.Errorf("RetrieveStreamFrom returned %+v, %v, %q, expected %+v at version 4", page, pageFirst, pageErr, ev3)
+		case versionErr != nil || version != 4:
+			t.Errorf("StreamVersion returned %v, %q, expected 4", version, versionErr)
+		case allErr != nil || len(all) != 4:
+			t.Errorf("RetrieveAll returned %v events, %q, expected the 4 events and tombstone", len(all), allErr)
+		}
+	})
+}
+
+// failingStorage fails reading stream versions with a short error, which
+// mustn't be mistaken for NOT_FOUND.
+type failingStorage struct {
+	storage.Storage
+}
+
+func (me failingStorage) StreamVersion(streamId uuid.UUID) (uint32, error) {
+	return 0, errors.New("EOF")
+}
+
+func TestStreamVersionErrorsShorterThanNotFoundAreReturned(t *testing.T) {
+	setUpWith(func(string) storage.Storage { return failingStorage{storage.NewInMemoryStorage()} })
 	defer tearDown()
 
-	aggregateId1 := uuid.NewV4()
-	aggregateId2 := uuid.NewV4()
-	testEvent1 := wrapEvent(aggregateId1, AnEvent{int64(123), "Hello 1"})
-	testEvent2 := wrapEvent(aggregateId2, AnEvent{int64(456), "Hello 2"})
-	testEvent3 := wrapEvent(aggregateId1, AnEvent{int64(789), "Hello 3"})
-	handler.AddEvent(testEvent1, actions.NO_EXPECTEDVERSION)
-	handler.AddEvent(testEvent2, actions.NO_EXPECTEDVERSION)
-	handler.AddEvent(testEvent3, actions.NO_EXPECTEDVERSION)
-
-	events, err := handler.RetrieveAll()
-	switch {
-	case err != nil:
-		t.Errorf("RetrieveAll failed with %q %q", err, tempDir)
-	case len(events) != 3:
-		t.Errorf("RetrieveAll returned %v events, expected %v", len(events), 3)
-	case !testEvent1.Equals(events[0]) || !testEvent2.Equals(events[1]) || !testEvent3.Equals(events[2]):
-		t.Error("RetrieveAll returned events in wrong order.")
+	_, versionErr := handler.StreamVersion(uuid.NewV4())
+	addErr := handler.AddEvent(wrapEvent(uuid.NewV4(), AnEvent{int64(1), "Hello"}), 0)
+
+	if versionErr == nil || versionErr.Error() != "EOF" {
+		t.Errorf("StreamVersion returned %q, expected EOF", versionErr)
+	}
+	if addErr == nil || addErr.Error() != "EOF" {
+		t.Errorf("AddEvent with an expected version returned %q, expected EOF", addErr)
 	}
 }
 
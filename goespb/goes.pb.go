@@ -0,0 +1,835 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: goes.proto
+
+package goespb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	timestamp "github.com/golang/protobuf/ptypes/timestamp"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type Event struct {
+	StreamId string `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	// Version of the event in its stream, from 1. Set by ReadStream.
+	Version uint32 `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	// Global position of the event, from 0. Set by ReadAll and Subscribe.
+	Position             uint64               `protobuf:"varint,3,opt,name=position,proto3" json:"position,omitempty"`
+	TypeId               string               `protobuf:"bytes,4,opt,name=type_id,json=typeId,proto3" json:"type_id,omitempty"`
+	CreationTime         *timestamp.Timestamp `protobuf:"bytes,5,opt,name=creation_time,json=creationTime,proto3" json:"creation_time,omitempty"`
+	Payload              []byte               `protobuf:"bytes,6,opt,name=payload,proto3" json:"payload,omitempty"`
+	MetadataTypeId       string               `protobuf:"bytes,7,opt,name=metadata_type_id,json=metadataTypeId,proto3" json:"metadata_type_id,omitempty"`
+	Metadata             []byte               `protobuf:"bytes,8,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *Event) Reset()         { *m = Event{} }
+func (m *Event) String() string { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()    {}
+func (*Event) Descriptor() ([]byte, []int) {
+	return fileDescriptor_79766a5b974d95d0, []int{0}
+}
+
+func (m *Event) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Event.Unmarshal(m, b)
+}
+func (m *Event) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Event.Marshal(b, m, deterministic)
+}
+func (m *Event) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Event.Merge(m, src)
+}
+func (m *Event) XXX_Size() int {
+	return xxx_messageInfo_Event.Size(m)
+}
+func (m *Event) XXX_DiscardUnknown() {
+	xxx_messageInfo_Event.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Event proto.InternalMessageInfo
+
+func (m *Event) GetStreamId() string {
+	if m != nil {
+		return m.StreamId
+	}
+	return ""
+}
+
+func (m *Event) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *Event) GetPosition() uint64 {
+	if m != nil {
+		return m.Position
+	}
+	return 0
+}
+
+func (m *Event) GetTypeId() string {
+	if m != nil {
+		return m.TypeId
+	}
+	return ""
+}
+
+func (m *Event) GetCreationTime() *timestamp.Timestamp {
+	if m != nil {
+		return m.CreationTime
+	}
+	return nil
+}
+
+func (m *Event) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Event) GetMetadataTypeId() string {
+	if m != nil {
+		return m.MetadataTypeId
+	}
+	return ""
+}
+
+func (m *Event) GetMetadata() []byte {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+type AppendRequest struct {
+	StreamId string `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	// Number of events the stream must have, unset to append regardless.
+	ExpectedVersion *wrappers.UInt32Value `protobuf:"bytes,2,opt,name=expected_version,json=expectedVersion,proto3" json:"expected_version,omitempty"`
+	TypeId          string                `protobuf:"bytes,3,opt,name=type_id,json=typeId,proto3" json:"type_id,omitempty"`
+	Payload         []byte                `protobuf:"bytes,4,opt,name=payload,proto3" json:"payload,omitempty"`
+	// Required along metadata.
+	MetadataTypeId       string   `protobuf:"bytes,5,opt,name=metadata_type_id,json=metadataTypeId,proto3" json:"metadata_type_id,omitempty"`
+	Metadata             []byte   `protobuf:"bytes,6,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AppendRequest) Reset()         { *m = AppendRequest{} }
+func (m *AppendRequest) String() string { return proto.CompactTextString(m) }
+func (*AppendRequest) ProtoMessage()    {}
+func (*AppendRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_79766a5b974d95d0, []int{1}
+}
+
+func (m *AppendRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AppendRequest.Unmarshal(m, b)
+}
+func (m *AppendRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AppendRequest.Marshal(b, m, deterministic)
+}
+func (m *AppendRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AppendRequest.Merge(m, src)
+}
+func (m *AppendRequest) XXX_Size() int {
+	return xxx_messageInfo_AppendRequest.Size(m)
+}
+func (m *AppendRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_AppendRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AppendRequest proto.InternalMessageInfo
+
+func (m *AppendRequest) GetStreamId() string {
+	if m != nil {
+		return m.StreamId
+	}
+	return ""
+}
+
+func (m *AppendRequest) GetExpectedVersion() *wrappers.UInt32Value {
+	if m != nil {
+		return m.ExpectedVersion
+	}
+	return nil
+}
+
+func (m *AppendRequest) GetTypeId() string {
+	if m != nil {
+		return m.TypeId
+	}
+	return ""
+}
+
+func (m *AppendRequest) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *AppendRequest) GetMetadataTypeId() string {
+	if m != nil {
+		return m.MetadataTypeId
+	}
+	return ""
+}
+
+func (m *AppendRequest) GetMetadata() []byte {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+type AppendResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AppendResponse) Reset()         { *m = AppendResponse{} }
+func (m *AppendResponse) String() string { return proto.CompactTextString(m) }
+func (*AppendResponse) ProtoMessage()    {}
+func (*AppendResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_79766a5b974d95d0, []int{2}
+}
+
+func (m *AppendResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AppendResponse.Unmarshal(m, b)
+}
+func (m *AppendResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AppendResponse.Marshal(b, m, deterministic)
+}
+func (m *AppendResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AppendResponse.Merge(m, src)
+}
+func (m *AppendResponse) XXX_Size() int {
+	return xxx_messageInfo_AppendResponse.Size(m)
+}
+func (m *AppendResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_AppendResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AppendResponse proto.InternalMessageInfo
+
+type ReadStreamRequest struct {
+	StreamId string `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	// Version of the first event to send, 0 or 1 for the whole stream.
+	FromVersion          uint32   `protobuf:"varint,2,opt,name=from_version,json=fromVersion,proto3" json:"from_version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReadStreamRequest) Reset()         { *m = ReadStreamRequest{} }
+func (m *ReadStreamRequest) String() string { return proto.CompactTextString(m) }
+func (*ReadStreamRequest) ProtoMessage()    {}
+func (*ReadStreamRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_79766a5b974d95d0, []int{3}
+}
+
+func (m *ReadStreamRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReadStreamRequest.Unmarshal(m, b)
+}
+func (m *ReadStreamRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReadStreamRequest.Marshal(b, m, deterministic)
+}
+func (m *ReadStreamRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReadStreamRequest.Merge(m, src)
+}
+func (m *ReadStreamRequest) XXX_Size() int {
+	return xxx_messageInfo_ReadStreamRequest.Size(m)
+}
+func (m *ReadStreamRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReadStreamRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReadStreamRequest proto.InternalMessageInfo
+
+func (m *ReadStreamRequest) GetStreamId() string {
+	if m != nil {
+		return m.StreamId
+	}
+	return ""
+}
+
+func (m *ReadStreamRequest) GetFromVersion() uint32 {
+	if m != nil {
+		return m.FromVersion
+	}
+	return 0
+}
+
+type ReadAllRequest struct {
+	FromPosition         uint64   `protobuf:"varint,1,opt,name=from_position,json=fromPosition,proto3" json:"from_position,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReadAllRequest) Reset()         { *m = ReadAllRequest{} }
+func (m *ReadAllRequest) String() string { return proto.CompactTextString(m) }
+func (*ReadAllRequest) ProtoMessage()    {}
+func (*ReadAllRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_79766a5b974d95d0, []int{4}
+}
+
+func (m *ReadAllRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReadAllRequest.Unmarshal(m, b)
+}
+func (m *ReadAllRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReadAllRequest.Marshal(b, m, deterministic)
+}
+func (m *ReadAllRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReadAllRequest.Merge(m, src)
+}
+func (m *ReadAllRequest) XXX_Size() int {
+	return xxx_messageInfo_ReadAllRequest.Size(m)
+}
+func (m *ReadAllRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReadAllRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReadAllRequest proto.InternalMessageInfo
+
+func (m *ReadAllRequest) GetFromPosition() uint64 {
+	if m != nil {
+		return m.FromPosition
+	}
+	return 0
+}
+
+type SubscribeRequest struct {
+	FromPosition uint64 `protobuf:"varint,1,opt,name=from_position,json=fromPosition,proto3" json:"from_position,omitempty"`
+	// Only sends the events of this stream when set.
+	StreamId string `protobuf:"bytes,2,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	// Only sends the events of this type when set.
+	TypeId               string   `protobuf:"bytes,3,opt,name=type_id,json=typeId,proto3" json:"type_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeRequest) Reset()         { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()    {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_79766a5b974d95d0, []int{5}
+}
+
+func (m *SubscribeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeRequest.Unmarshal(m, b)
+}
+func (m *SubscribeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeRequest.Marshal(b, m, deterministic)
+}
+func (m *SubscribeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeRequest.Merge(m, src)
+}
+func (m *SubscribeRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeRequest.Size(m)
+}
+func (m *SubscribeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeRequest proto.InternalMessageInfo
+
+func (m *SubscribeRequest) GetFromPosition() uint64 {
+	if m != nil {
+		return m.FromPosition
+	}
+	return 0
+}
+
+func (m *SubscribeRequest) GetStreamId() string {
+	if m != nil {
+		return m.StreamId
+	}
+	return ""
+}
+
+func (m *SubscribeRequest) GetTypeId() string {
+	if m != nil {
+		return m.TypeId
+	}
+	return ""
+}
+
+type DeleteStreamRequest struct {
+	StreamId string `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	// Number of events the stream must have, unset to delete regardless.
+	ExpectedVersion      *wrappers.UInt32Value `protobuf:"bytes,2,opt,name=expected_version,json=expectedVersion,proto3" json:"expected_version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
+}
+
+func (m *DeleteStreamRequest) Reset()         { *m = DeleteStreamRequest{} }
+func (m *DeleteStreamRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteStreamRequest) ProtoMessage()    {}
+func (*DeleteStreamRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_79766a5b974d95d0, []int{6}
+}
+
+func (m *DeleteStreamRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteStreamRequest.Unmarshal(m, b)
+}
+func (m *DeleteStreamRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteStreamRequest.Marshal(b, m, deterministic)
+}
+func (m *DeleteStreamRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteStreamRequest.Merge(m, src)
+}
+func (m *DeleteStreamRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteStreamRequest.Size(m)
+}
+func (m *DeleteStreamRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteStreamRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteStreamRequest proto.InternalMessageInfo
+
+func (m *DeleteStreamRequest) GetStreamId() string {
+	if m != nil {
+		return m.StreamId
+	}
+	return ""
+}
+
+func (m *DeleteStreamRequest) GetExpectedVersion() *wrappers.UInt32Value {
+	if m != nil {
+		return m.ExpectedVersion
+	}
+	return nil
+}
+
+type DeleteStreamResponse struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteStreamResponse) Reset()         { *m = DeleteStreamResponse{} }
+func (m *DeleteStreamResponse) String() string { return proto.CompactTextString(m) }
+func (*DeleteStreamResponse) ProtoMessage()    {}
+func (*DeleteStreamResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_79766a5b974d95d0, []int{7}
+}
+
+func (m *DeleteStreamResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteStreamResponse.Unmarshal(m, b)
+}
+func (m *DeleteStreamResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteStreamResponse.Marshal(b, m, deterministic)
+}
+func (m *DeleteStreamResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteStreamResponse.Merge(m, src)
+}
+func (m *DeleteStreamResponse) XXX_Size() int {
+	return xxx_messageInfo_DeleteStreamResponse.Size(m)
+}
+func (m *DeleteStreamResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteStreamResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteStreamResponse proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterType((*Event)(nil), "goes.Event")
+	proto.RegisterType((*AppendRequest)(nil), "goes.AppendRequest")
+	proto.RegisterType((*AppendResponse)(nil), "goes.AppendResponse")
+	proto.RegisterType((*ReadStreamRequest)(nil), "goes.ReadStreamRequest")
+	proto.RegisterType((*ReadAllRequest)(nil), "goes.ReadAllRequest")
+	proto.RegisterType((*SubscribeRequest)(nil), "goes.SubscribeRequest")
+	proto.RegisterType((*DeleteStreamRequest)(nil), "goes.DeleteStreamRequest")
+	proto.RegisterType((*DeleteStreamResponse)(nil), "goes.DeleteStreamResponse")
+}
+
+func init() {
+	proto.RegisterFile("goes.proto", fileDescriptor_79766a5b974d95d0)
+}
+
+var fileDescriptor_79766a5b974d95d0 = []byte{
+	// 525 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x54, 0xcd, 0x6e, 0xd3, 0x4c,
+	0x14, 0x95, 0xd3, 0xc4, 0x49, 0x6e, 0x7e, 0xbe, 0x7c, 0xd3, 0xa8, 0x35, 0x06, 0x41, 0x30, 0x1b,
+	0xaf, 0x5c, 0x94, 0xc0, 0x1a, 0x15, 0x51, 0x55, 0xd9, 0x21, 0xa7, 0x74, 0xc1, 0x26, 0x9a, 0xc4,
+	0xb7, 0x51, 0x24, 0x3b, 0x33, 0x78, 0x26, 0x85, 0x8a, 0xd7, 0x60, 0xc9, 0x33, 0xf2, 0x0c, 0x68,
+	0x66, 0x32, 0x49, 0xec, 0x16, 0x85, 0x4a, 0xec, 0x7c, 0xcf, 0xfd, 0x99, 0x7b, 0xce, 0xb9, 0x32,
+	0xc0, 0x82, 0xa1, 0x88, 0x78, 0xce, 0x24, 0x23, 0x55, 0xf5, 0xed, 0xbf, 0x58, 0x30, 0xb6, 0x48,
+	0xf1, 0x4c, 0x63, 0xb3, 0xf5, 0xcd, 0x99, 0x5c, 0x66, 0x28, 0x24, 0xcd, 0xb8, 0x29, 0xf3, 0x9f,
+	0x97, 0x0b, 0xbe, 0xe6, 0x94, 0x73, 0xcc, 0x37, 0x63, 0x82, 0x1f, 0x15, 0xa8, 0x5d, 0xdc, 0xe2,
+	0x4a, 0x92, 0xa7, 0xd0, 0x14, 0x32, 0x47, 0x9a, 0x4d, 0x97, 0x89, 0xe7, 0x0c, 0x9c, 0xb0, 0x19,
+	0x37, 0x0c, 0x30, 0x4e, 0x88, 0x07, 0xf5, 0x5b, 0xcc, 0xc5, 0x92, 0xad, 0xbc, 0xca, 0xc0, 0x09,
+	0x3b, 0xb1, 0x0d, 0x89, 0x0f, 0x0d, 0xce, 0xc4, 0x52, 0xaa, 0xd4, 0xd1, 0xc0, 0x09, 0xab, 0xf1,
+	0x36, 0x26, 0xa7, 0x50, 0x97, 0x77, 0x1c, 0xd5, 0xc0, 0xaa, 0x1e, 0xe8, 0xaa, 0x70, 0x9c, 0x90,
+	0x77, 0xd0, 0x99, 0xe7, 0x48, 0x55, 0xd1, 0x54, 0x6d, 0xec, 0xd5, 0x06, 0x4e, 0xd8, 0x1a, 0xfa,
+	0x91, 0xd9, 0x36, 0xb2, 0xdb, 0x46, 0x57, 0x96, 0x4e, 0xdc, 0xb6, 0x0d, 0x0a, 0x52, 0xfb, 0x70,
+	0x7a, 0x97, 0x32, 0x9a, 0x78, 0xee, 0xc0, 0x09, 0xdb, 0xb1, 0x0d, 0x49, 0x08, 0xbd, 0x0c, 0x25,
+	0x4d, 0xa8, 0xa4, 0x53, 0xfb, 0x78, 0x5d, 0x3f, 0xde, 0xb5, 0xf8, 0x95, 0x59, 0xc2, 0x87, 0x86,
+	0x45, 0xbc, 0x86, 0x1e, 0xb2, 0x8d, 0x83, 0x5f, 0x0e, 0x74, 0xce, 0x39, 0xc7, 0x55, 0x12, 0xe3,
+	0x97, 0x35, 0x8a, 0x03, 0xf2, 0x5c, 0x42, 0x0f, 0xbf, 0x71, 0x9c, 0x4b, 0x4c, 0xa6, 0xfb, 0x3a,
+	0xb5, 0x86, 0xcf, 0xee, 0x51, 0xfa, 0x34, 0x5e, 0xc9, 0xd1, 0xf0, 0x9a, 0xa6, 0x6b, 0x8c, 0xff,
+	0xb3, 0x5d, 0xd7, 0x1b, 0x35, 0xf7, 0x14, 0x3b, 0x2a, 0x28, 0xb6, 0x47, 0xb8, 0x7a, 0x98, 0x70,
+	0xed, 0x20, 0x61, 0xb7, 0x44, 0xb8, 0x07, 0x5d, 0xcb, 0x57, 0x70, 0xb6, 0x12, 0x18, 0x4c, 0xe0,
+	0xff, 0x18, 0x69, 0x32, 0xd1, 0x1c, 0xff, 0x4a, 0x85, 0x97, 0xd0, 0xbe, 0xc9, 0x59, 0x36, 0x2d,
+	0x5e, 0x4a, 0x4b, 0x61, 0x1b, 0x7e, 0xc1, 0x5b, 0xe8, 0xaa, 0xa1, 0xe7, 0x69, 0x6a, 0x27, 0xbe,
+	0x82, 0x8e, 0x6e, 0xda, 0x1e, 0x91, 0xa3, 0x8f, 0x48, 0x4f, 0xfa, 0xb8, 0xc1, 0x82, 0x0c, 0x7a,
+	0x93, 0xf5, 0x4c, 0xcc, 0xf3, 0xe5, 0x0c, 0x1f, 0xd3, 0x58, 0xdc, 0xb7, 0x52, 0xda, 0xf7, 0x4f,
+	0x62, 0x07, 0xdf, 0xe1, 0xf8, 0x03, 0xa6, 0x28, 0xf1, 0x11, 0xe4, 0xff, 0xd5, 0x09, 0x04, 0x27,
+	0xd0, 0x2f, 0x3e, 0x6e, 0xfc, 0x18, 0xfe, 0xac, 0x40, 0xf5, 0x92, 0xa1, 0x20, 0x23, 0x70, 0x8d,
+	0x55, 0xe4, 0x38, 0xd2, 0x3f, 0x84, 0xc2, 0xa1, 0xfa, 0xfd, 0x22, 0x68, 0xba, 0xc9, 0x1b, 0x80,
+	0x9d, 0x9b, 0xe4, 0xd4, 0xd4, 0xdc, 0xf3, 0xd7, 0x6f, 0x99, 0x84, 0xfe, 0x23, 0xbc, 0x76, 0x48,
+	0x04, 0xf5, 0x8d, 0x5d, 0xa4, 0xbf, 0x6b, 0xd9, 0xb9, 0x57, 0xae, 0x1f, 0x42, 0x73, 0xeb, 0x13,
+	0x39, 0x31, 0xb9, 0xb2, 0x71, 0xe5, 0x9e, 0x0b, 0x68, 0xef, 0xf3, 0x25, 0x4f, 0x4c, 0xfa, 0x01,
+	0x03, 0x7c, 0xff, 0xa1, 0x94, 0x21, 0xf8, 0xbe, 0xf1, 0xd9, 0x55, 0x49, 0x3e, 0x9b, 0xb9, 0x5a,
+	0xe7, 0xd1, 0xef, 0x01, 0x00, 0x46, 0x73, 0x76, 0x1a, 0x2e, 0x05, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// GoesClient is the client API for Goes service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type GoesClient interface {
+	// Append appends an event to a stream, failing with FAILED_PRECONDITION
+	// when expected_version is set and the stream doesn't have that many events.
+	Append(ctx context.Context, in *AppendRequest, opts ...grpc.CallOption) (*AppendResponse, error)
+	// ReadStream sends the events of a stream in order, with their version.
+	ReadStream(ctx context.Context, in *ReadStreamRequest, opts ...grpc.CallOption) (Goes_ReadStreamClient, error)
+	// ReadAll sends all events in global order, with their position.
+	ReadAll(ctx context.Context, in *ReadAllRequest, opts ...grpc.CallOption) (Goes_ReadAllClient, error)
+	// Subscribe sends the events of all streams, of a stream or of a type from a
+	// global position on, then each event as it is appended, until cancelled.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Goes_SubscribeClient, error)
+	// DeleteStream appends a $StreamDeleted tombstone to a stream. ReadStream
+	// skips the events of a stream up to its last tombstone, versions going on
+	// from the tombstone's; ReadAll and Subscribe still send them.
+	DeleteStream(ctx context.Context, in *DeleteStreamRequest, opts ...grpc.CallOption) (*DeleteStreamResponse, error)
+}
+
+type goesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGoesClient(cc grpc.ClientConnInterface) GoesClient {
+	return &goesClient{cc}
+}
+
+func (c *goesClient) Append(ctx context.Context, in *AppendRequest, opts ...grpc.CallOption) (*AppendResponse, error) {
+	out := new(AppendResponse)
+	err := c.cc.Invoke(ctx, "/goes.Goes/Append", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *goesClient) ReadStream(ctx context.Context, in *ReadStreamRequest, opts ...grpc.CallOption) (Goes_ReadStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Goes_serviceDesc.Streams[0], "/goes.Goes/ReadStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &goesReadStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Goes_ReadStreamClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type goesReadStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *goesReadStreamClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *goesClient) ReadAll(ctx context.Context, in *ReadAllRequest, opts ...grpc.CallOption) (Goes_ReadAllClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Goes_serviceDesc.Streams[1], "/goes.Goes/ReadAll", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &goesReadAllClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Goes_ReadAllClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type goesReadAllClient struct {
+	grpc.ClientStream
+}
+
+func (x *goesReadAllClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *goesClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Goes_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Goes_serviceDesc.Streams[2], "/goes.Goes/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &goesSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Goes_SubscribeClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type goesSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *goesSubscribeClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *goesClient) DeleteStream(ctx context.Context, in *DeleteStreamRequest, opts ...grpc.CallOption) (*DeleteStreamResponse, error) {
+	out := new(DeleteStreamResponse)
+	err := c.cc.Invoke(ctx, "/goes.Goes/DeleteStream", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GoesServer is the server API for Goes service.
+type GoesServer interface {
+	// Append appends an event to a stream, failing with FAILED_PRECONDITION
+	// when expected_version is set and the stream doesn't have that many events.
+	Append(context.Context, *AppendRequest) (*AppendResponse, error)
+	// ReadStream sends the events of a stream in order, with their version.
+	ReadStream(*ReadStreamRequest, Goes_ReadStreamServer) error
+	// ReadAll sends all events in global order, with their position.
+	ReadAll(*ReadAllRequest, Goes_ReadAllServer) error
+	// Subscribe sends the events of all streams, of a stream or of a type from a
+	// global position on, then each event as it is appended, until cancelled.
+	Subscribe(*SubscribeRequest, Goes_SubscribeServer) error
+	// DeleteStream appends a $StreamDeleted tombstone to a stream. ReadStream
+	// skips the events of a stream up to its last tombstone, versions going on
+	// from the tombstone's; ReadAll and Subscribe still send them.
+	DeleteStream(context.Context, *DeleteStreamRequest) (*DeleteStreamResponse, error)
+}
+
+// UnimplementedGoesServer can be embedded to have forward compatible implementations.
+type UnimplementedGoesServer struct {
+}
+
+func (*UnimplementedGoesServer) Append(ctx context.Context, req *AppendRequest) (*AppendResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Append not implemented")
+}
+func (*UnimplementedGoesServer) ReadStream(req *ReadStreamRequest, srv Goes_ReadStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ReadStream not implemented")
+}
+func (*UnimplementedGoesServer) ReadAll(req *ReadAllRequest, srv Goes_ReadAllServer) error {
+	return status.Errorf(codes.Unimplemented, "method ReadAll not implemented")
+}
+func (*UnimplementedGoesServer) Subscribe(req *SubscribeRequest, srv Goes_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (*UnimplementedGoesServer) DeleteStream(ctx context.Context, req *DeleteStreamRequest) (*DeleteStreamResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteStream not implemented")
+}
+
+func RegisterGoesServer(s *grpc.Server, srv GoesServer) {
+	s.RegisterService(&_Goes_serviceDesc, srv)
+}
+
+func _Goes_Append_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AppendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoesServer).Append(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goes.Goes/Append",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoesServer).Append(ctx, req.(*AppendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Goes_ReadStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadStreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GoesServer).ReadStream(m, &goesReadStreamServer{stream})
+}
+
+type Goes_ReadStreamServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type goesReadStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *goesReadStreamServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Goes_ReadAll_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadAllRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GoesServer).ReadAll(m, &goesReadAllServer{stream})
+}
+
+type Goes_ReadAllServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type goesReadAllServer struct {
+	grpc.ServerStream
+}
+
+func (x *goesReadAllServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Goes_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GoesServer).Subscribe(m, &goesSubscribeServer{stream})
+}
+
+type Goes_SubscribeServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type goesSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *goesSubscribeServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Goes_DeleteStream_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteStreamRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GoesServer).DeleteStream(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goes.Goes/DeleteStream",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GoesServer).DeleteStream(ctx, req.(*DeleteStreamRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Goes_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "goes.Goes",
+	HandlerType: (*GoesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Append",
+			Handler:    _Goes_Append_Handler,
+		},
+		{
+			MethodName: "DeleteStream",
+			Handler:    _Goes_DeleteStream_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ReadStream",
+			Handler:       _Goes_ReadStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReadAll",
+			Handler:       _Goes_ReadAll_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Goes_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "goes.proto",
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	storage "./storage"
+	"bytes"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func assertImported(t *testing.T, imported []*storage.StoredEvent, expected []*storage.StoredEvent) {
+	if len(imported) != len(expected) {
+		t.Fatalf("Import failed. Got %v events, expected %v", len(imported), len(expected))
+	}
+	for i, event := range imported {
+		if event.StreamId != expected[i].StreamId || !event.CreationTime.Equal(expected[i].CreationTime) || event.TypeId != expected[i].TypeId ||
+			!bytes.Equal(event.Data, expected[i].Data) || event.MetadataTypeId != expected[i].MetadataTypeId || !bytes.Equal(event.Metadata, expected[i].Metadata) {
+			t.Errorf("Import failed. Event %v is %+v, expected %+v", i, event, expected[i])
+		}
+	}
+}
+
+func TestImportJsonLines(t *testing.T) {
+	streamId := uuid.NewV4()
+	jsonLines := `{"streamId":"` + streamId.String() + `","typeId":"AnEvent","creationTime":"2016-02-11T09:53:32.001234567Z","payload":"eyJBIjoxfQ==","metadataTypeId":"Metadata","metadata":"e30="}
+{"streamId":"` + streamId.String() + `","typeId":"AnotherEvent","creationTime":"2016-02-11T09:53:33Z","payload":"AAEC","metadata":null}
+`
+	expected := []*storage.StoredEvent{
+		{StreamId: streamId, CreationTime: time.Date(2016, 2, 11, 9, 53, 32, 1234567, time.UTC), TypeId: "AnEvent", Data: []byte(`{"A":1}`), MetadataTypeId: "Metadata", Metadata: []byte("{}")},
+		{StreamId: streamId, CreationTime: time.Date(2016, 2, 11, 9, 53, 33, 0, time.UTC), TypeId: "AnotherEvent", Data: []byte{0, 1, 2}},
+	}
+
+	for name, newStorage := range backends {
+		t.Run(name, func(t *testing.T) {
+			setUpWith(newStorage)
+			defer tearDown()
+
+			count, err := importJsonLines(_storage, strings.NewReader(jsonLines))
+			if err != nil || count != 2 {
+				t.Fatalf("Import failed. Imported %v events, error %v", count, err)
+			}
+			imported, err := _storage.ReadAll()
+			if err != nil {
+				t.Fatalf("ReadAll failed. Error: %v", err)
+			}
+			assertImported(t, imported, expected)
+		})
+	}
+}
+
+func TestImportJsonLinesReportsBadRecord(t *testing.T) {
+	setUpWith(backends["InMemoryStorage"])
+	defer tearDown()
+
+	count, err := importJsonLines(_storage, strings.NewReader(`{"streamId":"not a uuid","typeId":"AnEvent"}`))
+
+	if err == nil || !strings.HasPrefix(err.Error(), "Record 1:") || count != 0 {
+		t.Errorf("Import failed. Got %v events and error %v, expected an error for record 1", count, err)
+	}
+}
+
+func TestImportBackup(t *testing.T) {
+	sourcePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(sourcePath)
+	source := storage.NewDailyDiskStorage(sourcePath)
+	for i := 0; i < 3; i++ {
+		source.Write(&storage.StoredEvent{StreamId: uuid.NewV4(), CreationTime: time.Now(), TypeId: "AnEvent", Data: []byte("{}"), MetadataTypeId: "Metadata", Metadata: []byte("{}")})
+	}
+	backupPath := sourcePath + ".backup"
+	defer os.RemoveAll(backupPath)
+	target, _ := storage.OpenBackupTarget(backupPath)
+	source.(storage.BackupStorage).Backup(target)
+	target.Close()
+	expected, _ := source.ReadAll()
+
+	before := snapshotFiles(t, backupPath)
+
+	setUpWith(backends["BoltStorage"])
+	defer tearDown()
+	count, err := importBackup(_storage, backupPath)
+
+	if err != nil || count != 3 {
+		t.Fatalf("Import failed. Imported %v events, error %v", count, err)
+	}
+	imported, _ := _storage.ReadAll()
+	assertImported(t, imported, expected)
+	if after := snapshotFiles(t, backupPath); !reflect.DeepEqual(after, before) {
+		t.Errorf("Import modified the backup. Files before: %v, after: %v", before, after)
+	}
+}
+
+func TestImportBackupOfMissingStoreFails(t *testing.T) {
+	backupPath := path.Join(os.TempDir(), uuid.NewV4().String())
+	setUpWith(backends["InMemoryStorage"])
+	defer tearDown()
+
+	count, err := importBackup(_storage, backupPath)
+
+	if err == nil || count != 0 {
+		t.Errorf("Import failed. Got %v events and error %v, expected an error", count, err)
+	}
+	if _, err := os.Stat(backupPath); !os.IsNotExist(err) {
+		os.RemoveAll(backupPath)
+		t.Errorf("Import created the missing backup. Error: %v", err)
+	}
+}
+
+// snapshotFiles returns the content of every file under dir by path.
+func snapshotFiles(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(filename)
+		files[filename] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pebbe/zmq4"
+	"io/ioutil"
+	"os"
+)
+
+// keygen writes a new CURVE key pair to <name>.key, readable only by its
+// owner, and <name>.pub, e.g. `goes keygen server` for --curveKey=server.key.
+// It refuses to overwrite existing keys.
+func keygen(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Usage: goes keygen <name>")
+	}
+	publicKey, secretKey, err := zmq4.NewCurveKeypair()
+	if err != nil {
+		return err
+	}
+	secretFile, publicFile := args[0]+".key", args[0]+".pub"
+	for _, filename := range []string{secretFile, publicFile} {
+		if _, err := os.Stat(filename); err == nil {
+			return errors.New(filename + " already exists.")
+		}
+	}
+	if err = ioutil.WriteFile(secretFile, []byte(secretKey+"\n"), 0600); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(publicFile, []byte(publicKey+"\n"), 0644); err != nil {
+		return err
+	}
+	fmt.Println("Wrote the secret key to", secretFile, "and the public key", publicKey, "to", publicFile)
+	return nil
+}
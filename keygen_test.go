@@ -0,0 +1,37 @@
+package main
+
+import (
+	zmqtransport "./server/zmqtransport"
+	"github.com/pebbe/zmq4"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestKeygenWritesAKeyPair(t *testing.T) {
+	setUpWith(backends["InMemoryStorage"])
+	defer tearDown()
+	os.MkdirAll(tempDir, 0777)
+	name := path.Join(tempDir, "server")
+
+	err := keygen([]string{name})
+	againErr := keygen([]string{name})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretKey, secretErr := zmqtransport.ReadKeyFile(name + ".key")
+	publicKey, publicErr := zmqtransport.ReadKeyFile(name + ".pub")
+	if secretErr != nil || publicErr != nil {
+		t.Fatal(secretErr, publicErr)
+	}
+	if derived, _ := zmq4.AuthCurvePublic(secretKey); derived != publicKey {
+		t.Errorf("Public key %v doesn't match the secret key", publicKey)
+	}
+	if info, _ := os.Stat(name + ".key"); info.Mode().Perm() != 0600 {
+		t.Errorf("Secret key file has mode %v", info.Mode())
+	}
+	if againErr == nil {
+		t.Errorf("keygen overwrote the key pair")
+	}
+}
@@ -2,6 +2,7 @@
 # Install Goes
 go get github.com/satori/go.uuid
 go get github.com/pebbe/zmq4
+go get github.com/boltdb/bolt
 go build -o bin/goes
 
 sudo mkdir /opt/goes
@@ -1,6 +1,7 @@
 package serializer
 
 import (
+	data "../data"
 	"reflect"
 	"encoding/json"
 	"errors"
@@ -47,6 +48,9 @@ func (me *JsonSerializer) Deserialize(serialized []byte, typeId string) (interfa
 	if (typeId == "") {
 		return nil, nil
 	}
+	if typeId == data.STREAM_DELETED_TYPE {
+		return data.StreamDeleted{}, nil
+	}
 	type_ := me.types[typeId]
 	if type_ == nil {
 		return nil, errors.New(fmt.Sprintf("type %q not registered in serializer", typeId))
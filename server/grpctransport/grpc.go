@@ -0,0 +1,295 @@
+// Package grpctransport serves the Goes service of goespb/goes.proto for a
+// server.Server.
+package grpctransport
+
+import (
+	actions "../../actions"
+	data "../../data"
+	goespb "../../goespb"
+	server "../../server"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/satori/go.uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"math"
+	"net"
+	"strings"
+	"sync"
+)
+
+// READ_ALL_PAGE_SIZE is how many events ReadAll reads at a time from the
+// storage while streaming them.
+const READ_ALL_PAGE_SIZE = 500
+
+type grpcServer struct {
+	handler  actions.Handler
+	stopping <-chan struct{}
+}
+
+// NewGrpcServer returns a gRPC server serving the Goes service of
+// goespb/goes.proto.
+func NewGrpcServer(handler actions.Handler) *grpc.Server {
+	return newGrpcServer(handler, nil)
+}
+
+// newGrpcServer returns a gRPC server whose subscriptions end once stopping is
+// closed.
+func newGrpcServer(handler actions.Handler, stopping <-chan struct{}, options ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(options...)
+	goespb.RegisterGoesServer(server, &grpcServer{handler, stopping})
+	return server
+}
+
+// GrpcTransport serves the gRPC service.
+type GrpcTransport struct {
+	listener net.Listener
+	stopping chan struct{}
+	lock     sync.Mutex
+	server   *grpc.Server
+}
+
+// NewGrpcTransport listens on addr, e.g. ":9090".
+func NewGrpcTransport(addr string) (*GrpcTransport, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &GrpcTransport{listener: listener, stopping: make(chan struct{})}, nil
+}
+
+func (me *GrpcTransport) Serve(server *server.Server) error {
+	me.lock.Lock()
+	select {
+	case <-me.stopping:
+		me.lock.Unlock()
+		return nil
+	default:
+	}
+	me.server = newGrpcServer(server.Handler(), me.stopping, trackCalls(server)...)
+	me.lock.Unlock()
+
+	fmt.Println("Listening for incoming gRPC requests on:", me.listener.Addr())
+	return me.server.Serve(me.listener)
+}
+
+// Close ends the subscriptions, then waits for the other calls in flight.
+func (me *GrpcTransport) Close() error {
+	me.lock.Lock()
+	close(me.stopping)
+	server := me.server
+	me.lock.Unlock()
+
+	if server == nil {
+		return me.listener.Close()
+	}
+	server.GracefulStop()
+	return nil
+}
+
+// trackCalls counts the calls in flight on server, which Run waits for, and
+// refuses those coming after Run.
+func trackCalls(srv *server.Server) []grpc.ServerOption {
+	unary := func(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := srv.Begin(); err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		defer srv.End()
+		return handler(ctx, request)
+	}
+	stream := func(service interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := srv.Begin(); err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		defer srv.End()
+		return handler(service, stream)
+	}
+	return []grpc.ServerOption{grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream)}
+}
+
+func grpcError(err error) error {
+	fmt.Println(err)
+	if strings.HasPrefix(err.Error(), "WrongExpectedVersion") {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if strings.HasPrefix(err.Error(), "Forbidden") {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func parseStreamId(streamId string) (uuid.UUID, error) {
+	parsed, err := uuid.FromString(streamId)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "Wrong format for stream id: "+err.Error())
+	}
+	return parsed, nil
+}
+
+func expectedVersion(version *wrappers.UInt32Value) uint32 {
+	if version == nil {
+		return actions.NO_EXPECTEDVERSION
+	}
+	return version.Value
+}
+
+func validateTypeId(name string, typeId string) error {
+	if typeId == "" || strings.Contains(typeId, " ") || strings.HasPrefix(typeId, "$") {
+		return status.Error(codes.InvalidArgument, name+" must be set and can't contain spaces or start with $")
+	}
+	return nil
+}
+
+func (me *grpcServer) Append(ctx context.Context, request *goespb.AppendRequest) (*goespb.AppendResponse, error) {
+	streamId, err := parseStreamId(request.StreamId)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateTypeId("type_id", request.TypeId); err != nil {
+		return nil, err
+	}
+	event := data.Event{AggregateId: streamId, Payload: append([]byte(request.TypeId+" "), request.Payload...)}
+	if request.MetadataTypeId != "" {
+		if err = validateTypeId("metadata_type_id", request.MetadataTypeId); err != nil {
+			return nil, err
+		}
+		event.Metadata = append([]byte(request.MetadataTypeId+" "), request.Metadata...)
+	} else if len(request.Metadata) > 0 {
+		return nil, status.Error(codes.InvalidArgument, "metadata_type_id must be set along metadata")
+	}
+
+	fmt.Println("-> gRPC Append", streamId.String(), request.TypeId)
+	if err = me.handler.AddEvent(event, expectedVersion(request.ExpectedVersion)); err != nil {
+		return nil, grpcError(err)
+	}
+	return &goespb.AppendResponse{}, nil
+}
+
+func (me *grpcServer) ReadStream(request *goespb.ReadStreamRequest, stream goespb.Goes_ReadStreamServer) error {
+	streamId, err := parseStreamId(request.StreamId)
+	if err != nil {
+		return err
+	}
+	fmt.Println("-> gRPC ReadStream", streamId.String(), request.FromVersion)
+	events, first, err := me.handler.RetrieveStreamFrom(streamId, request.FromVersion, math.MaxInt32)
+	if err != nil {
+		return grpcError(err)
+	}
+	if request.FromVersion > first {
+		first = request.FromVersion
+	}
+	for i, event := range events {
+		grpcEvent, err := newGrpcEvent(event)
+		if err != nil {
+			return grpcError(err)
+		}
+		grpcEvent.Version = first + uint32(i)
+		if err = stream.Send(grpcEvent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (me *grpcServer) ReadAll(request *goespb.ReadAllRequest, stream goespb.Goes_ReadAllServer) error {
+	fmt.Println("-> gRPC ReadAll", request.FromPosition)
+	position := request.FromPosition
+	for {
+		events, err := me.handler.RetrieveAllFrom(position, READ_ALL_PAGE_SIZE)
+		if err != nil {
+			return grpcError(err)
+		}
+		for _, event := range events {
+			grpcEvent, err := newGrpcEvent(event)
+			if err != nil {
+				return grpcError(err)
+			}
+			grpcEvent.Position = position
+			if err = stream.Send(grpcEvent); err != nil {
+				return err
+			}
+			position++
+		}
+		if len(events) < READ_ALL_PAGE_SIZE {
+			return nil
+		}
+	}
+}
+
+func (me *grpcServer) Subscribe(request *goespb.SubscribeRequest, stream goespb.Goes_SubscribeServer) error {
+	filter := actions.SubscriptionFilter{TypeId: request.TypeId}
+	if request.StreamId != "" {
+		streamId, err := parseStreamId(request.StreamId)
+		if err != nil {
+			return err
+		}
+		filter.StreamId = streamId
+	}
+
+	fmt.Println("-> gRPC Subscribe", request.StreamId, request.TypeId, request.FromPosition)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-stream.Context().Done():
+		case <-me.stopping:
+		}
+		close(done)
+	}()
+
+	sendErr := errors.New("Send failed")
+	err := me.handler.Subscribe(request.FromPosition, filter, done, func(position uint64, event *data.Event) error {
+		grpcEvent, err := newGrpcEvent(event)
+		if err != nil {
+			return err
+		}
+		grpcEvent.Position = position
+		if err = stream.Send(grpcEvent); err != nil {
+			sendErr = err
+			return sendErr
+		}
+		return nil
+	})
+	if err == sendErr {
+		return err
+	}
+	if err != nil {
+		return grpcError(err)
+	}
+	if err = stream.Context().Err(); err != nil {
+		return err
+	}
+	return status.Error(codes.Unavailable, "Server shutting down")
+}
+
+func (me *grpcServer) DeleteStream(ctx context.Context, request *goespb.DeleteStreamRequest) (*goespb.DeleteStreamResponse, error) {
+	streamId, err := parseStreamId(request.StreamId)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("-> gRPC DeleteStream", streamId.String())
+	if err = me.handler.DeleteStream(streamId, expectedVersion(request.ExpectedVersion)); err != nil {
+		return nil, grpcError(err)
+	}
+	return &goespb.DeleteStreamResponse{}, nil
+}
+
+func newGrpcEvent(event *data.Event) (*goespb.Event, error) {
+	creationTime, err := ptypes.TimestampProto(event.CreationTime)
+	if err != nil {
+		return nil, err
+	}
+	typeId, payload := server.SplitPassthru(event.Payload)
+	metadataTypeId, metadata := server.SplitPassthru(event.Metadata)
+	return &goespb.Event{
+		StreamId:       event.AggregateId.String(),
+		TypeId:         typeId,
+		CreationTime:   creationTime,
+		Payload:        payload,
+		MetadataTypeId: metadataTypeId,
+		Metadata:       metadata,
+	}, nil
+}
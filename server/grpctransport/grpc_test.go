@@ -0,0 +1,208 @@
+package grpctransport
+
+import (
+	actions "../../actions"
+	goespb "../../goespb"
+	serializer "../../serializer"
+	storage "../../storage"
+	"context"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/satori/go.uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func newGrpcTestClient(t *testing.T) (goespb.GoesClient, func()) {
+	handler := actions.NewActionsHandler(storage.NewInMemoryStorage(), serializer.NewPassthruSerializer())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewGrpcServer(handler)
+	go server.Serve(listener)
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return goespb.NewGoesClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func receiveAll(t *testing.T, stream interface {
+	Recv() (*goespb.Event, error)
+}) []*goespb.Event {
+	events := make([]*goespb.Event, 0)
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+}
+
+func TestGrpcAppendAndRead(t *testing.T) {
+	//Arrange
+	client, closeClient := newGrpcTestClient(t)
+	defer closeClient()
+	ctx := context.Background()
+	streamId := uuid.NewV4().String()
+
+	//Act
+	_, err := client.Append(ctx, &goespb.AppendRequest{StreamId: streamId, ExpectedVersion: &wrappers.UInt32Value{Value: 0}, TypeId: "AnEvent", Payload: []byte("1"), MetadataTypeId: "Metadata", Metadata: []byte("m")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Append(ctx, &goespb.AppendRequest{StreamId: uuid.NewV4().String(), TypeId: "OtherEvent", Payload: []byte("2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Append(ctx, &goespb.AppendRequest{StreamId: streamId, TypeId: "AnEvent", Payload: []byte("3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, wrongVersionErr := client.Append(ctx, &goespb.AppendRequest{StreamId: streamId, ExpectedVersion: &wrappers.UInt32Value{Value: 1}, TypeId: "AnEvent"})
+	_, badTypeErr := client.Append(ctx, &goespb.AppendRequest{StreamId: streamId, TypeId: "$StreamDeleted"})
+	streamReader, err := client.ReadStream(ctx, &goespb.ReadStreamRequest{StreamId: streamId, FromVersion: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamEvents := receiveAll(t, streamReader)
+	allReader, err := client.ReadAll(ctx, &goespb.ReadAllRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allEvents := receiveAll(t, allReader)
+
+	//Assert
+	if status.Code(wrongVersionErr) != codes.FailedPrecondition {
+		t.Errorf("Append with a wrong expected version failed with %v", wrongVersionErr)
+	}
+	if status.Code(badTypeErr) != codes.InvalidArgument {
+		t.Errorf("Append of a reserved type failed with %v", badTypeErr)
+	}
+	if len(streamEvents) != 1 || streamEvents[0].Version != 2 || string(streamEvents[0].Payload) != "3" {
+		t.Errorf("ReadStream got %v", streamEvents)
+	}
+	if len(allEvents) != 3 {
+		t.Fatalf("ReadAll got %v events, expected 3", len(allEvents))
+	}
+	first := allEvents[0]
+	if first.StreamId != streamId || first.TypeId != "AnEvent" || string(first.Payload) != "1" || first.MetadataTypeId != "Metadata" || string(first.Metadata) != "m" || first.CreationTime == nil {
+		t.Errorf("ReadAll got %v as first event", first)
+	}
+	if allEvents[2].Position != 2 {
+		t.Errorf("ReadAll got position %v for the last event", allEvents[2].Position)
+	}
+}
+
+func TestGrpcReadAllStreamsPageByPage(t *testing.T) {
+	//Arrange
+	client, closeClient := newGrpcTestClient(t)
+	defer closeClient()
+	ctx := context.Background()
+	for i := 0; i < READ_ALL_PAGE_SIZE+2; i++ {
+		client.Append(ctx, &goespb.AppendRequest{StreamId: uuid.NewV4().String(), TypeId: "AnEvent", Payload: []byte(strconv.Itoa(i))})
+	}
+
+	//Act
+	allReader, err := client.ReadAll(ctx, &goespb.ReadAllRequest{FromPosition: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allEvents := receiveAll(t, allReader)
+
+	//Assert
+	if len(allEvents) != READ_ALL_PAGE_SIZE+1 {
+		t.Fatalf("ReadAll got %v events, expected %v", len(allEvents), READ_ALL_PAGE_SIZE+1)
+	}
+	for i, event := range allEvents {
+		if event.Position != uint64(i+1) || string(event.Payload) != strconv.Itoa(i+1) {
+			t.Fatalf("ReadAll got %v at position %v", event, i+1)
+		}
+	}
+}
+
+func TestGrpcSubscribeAndDeleteStream(t *testing.T) {
+	//Arrange
+	client, closeClient := newGrpcTestClient(t)
+	defer closeClient()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	streamId := uuid.NewV4().String()
+	client.Append(ctx, &goespb.AppendRequest{StreamId: streamId, TypeId: "AnEvent", Payload: []byte("1")})
+	client.Append(ctx, &goespb.AppendRequest{StreamId: uuid.NewV4().String(), TypeId: "AnEvent", Payload: []byte("2")})
+
+	//Act
+	subscription, err := client.Subscribe(ctx, &goespb.SubscribeRequest{StreamId: streamId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caughtUp, err := subscription.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.DeleteStream(ctx, &goespb.DeleteStreamRequest{StreamId: streamId, ExpectedVersion: &wrappers.UInt32Value{Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tombstone, err := subscription.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	_, cancelled := subscription.Recv()
+
+	//Assert
+	if string(caughtUp.Payload) != "1" || caughtUp.Position != 0 {
+		t.Errorf("Subscribe got %v first", caughtUp)
+	}
+	if tombstone.TypeId != actions.STREAM_DELETED_TYPE || tombstone.Position != 2 {
+		t.Errorf("Subscribe got %v after DeleteStream", tombstone)
+	}
+	if status.Code(cancelled) != codes.Canceled {
+		t.Errorf("Subscribe ended with %v once cancelled", cancelled)
+	}
+}
+
+func TestGrpcReadStreamAfterDeleteStream(t *testing.T) {
+	//Arrange
+	client, closeClient := newGrpcTestClient(t)
+	defer closeClient()
+	ctx := context.Background()
+	streamId := uuid.NewV4().String()
+	client.Append(ctx, &goespb.AppendRequest{StreamId: streamId, TypeId: "AnEvent", Payload: []byte("1")})
+	client.DeleteStream(ctx, &goespb.DeleteStreamRequest{StreamId: streamId})
+	client.Append(ctx, &goespb.AppendRequest{StreamId: streamId, TypeId: "AnEvent", Payload: []byte("3")})
+	client.Append(ctx, &goespb.AppendRequest{StreamId: streamId, TypeId: "AnEvent", Payload: []byte("4")})
+
+	//Act
+	stream, err := client.ReadStream(ctx, &goespb.ReadStreamRequest{StreamId: streamId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := receiveAll(t, stream)
+	stream, err = client.ReadStream(ctx, &goespb.ReadStreamRequest{StreamId: streamId, FromVersion: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromEvents := receiveAll(t, stream)
+
+	//Assert
+	if len(events) != 2 || string(events[0].Payload) != "3" || events[0].Version != 3 || events[1].Version != 4 {
+		t.Errorf("ReadStream after DeleteStream got %v", events)
+	}
+	if len(fromEvents) != 1 || string(fromEvents[0].Payload) != "4" || fromEvents[0].Version != 4 {
+		t.Errorf("ReadStream from version 4 after DeleteStream got %v", fromEvents)
+	}
+}
@@ -0,0 +1,409 @@
+package server
+
+import (
+	actions "../actions"
+	data "../data"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const EXPECTED_VERSION_HEADER = "Expected-Version"
+const DEFAULT_PAGE_SIZE = 100
+const MAX_PAGE_SIZE = 1000
+
+// MAX_BODY_SIZE bounds the body of an append, the default message size limit
+// of gRPC.
+const MAX_BODY_SIZE = 4 << 20
+
+// HttpEvent is an event as sent and received by the HTTP API. Payload and
+// metadata are JSON values, unless encoding is "base64": they are then JSON
+// strings holding the base64 of any bytes. Version and position are only set
+// on reads.
+type HttpEvent struct {
+	StreamId       string          `json:"streamId,omitempty"`
+	Version        uint32          `json:"version,omitempty"`
+	Position       *uint64         `json:"position,omitempty"`
+	TypeId         string          `json:"typeId"`
+	CreationTime   *time.Time      `json:"creationTime,omitempty"`
+	Encoding       string          `json:"encoding,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	MetadataTypeId string          `json:"metadataTypeId,omitempty"`
+	Metadata       json.RawMessage `json:"metadata,omitempty"`
+}
+
+// HttpPage is a page of events. Next is the version or position to read the
+// following page from, if any.
+type HttpPage struct {
+	Events []*HttpEvent `json:"events"`
+	Next   *uint64      `json:"next,omitempty"`
+}
+
+type httpError struct {
+	Error string `json:"error"`
+}
+
+type httpHandler struct {
+	handler actions.Handler
+}
+
+// NewHttpHandler serves the HTTP API:
+//
+//	POST /streams/{streamId}  appends the event in the body, checking the
+//	                          Expected-Version header if any
+//	GET  /streams/{streamId}  reads a page of the stream, by version
+//	GET  /all                 reads a page of all events, by global position
+//	GET  /feed/all            streams all events as server-sent events
+//	GET  /feed/streams/{id}   streams the events of a stream
+//	GET  /feed/types/{typeId} streams the events of a type
+//
+// Reads take from, count and direction (forward or backward) parameters, feeds
+// take from or a Last-Event-ID header.
+func NewHttpHandler(handler actions.Handler) http.Handler {
+	mux := http.NewServeMux()
+	me := &httpHandler{handler}
+	mux.HandleFunc("/streams/", me.serveStream)
+	mux.HandleFunc("/all", me.serveAll)
+	mux.HandleFunc("/feed/", me.serveFeed)
+	return mux
+}
+
+// HttpTransport serves the HTTP API.
+type HttpTransport struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewHttpTransport listens on addr, e.g. ":8080". Closing the transport ends
+// the live feeds, which never become idle otherwise.
+func NewHttpTransport(addr string) (*HttpTransport, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	feeds, endFeeds := context.WithCancel(context.Background())
+	server := &http.Server{BaseContext: func(net.Listener) context.Context { return feeds }}
+	server.RegisterOnShutdown(endFeeds)
+	return &HttpTransport{listener, server}, nil
+}
+
+func (me *HttpTransport) Serve(server *Server) error {
+	me.server.Handler = track(server, NewHttpHandler(server.Handler()))
+	fmt.Println("Listening for incoming HTTP requests on:", me.listener.Addr())
+	err := me.server.Serve(me.listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Close waits up to SHUTDOWN_TIMEOUT for requests in flight, then closes
+// their connections.
+func (me *HttpTransport) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	err := me.server.Shutdown(ctx)
+	me.listener.Close()
+	if err != nil {
+		return me.server.Close()
+	}
+	return nil
+}
+
+// track counts the requests of handler in flight on server, which Run waits
+// for even once Close gave up on them, and refuses those coming after Run.
+func track(server *Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := server.Begin(); err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		defer server.End()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func writeJson(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	fmt.Println(err)
+	writeJson(w, status, &httpError{err.Error()})
+}
+
+func errorStatus(err error) int {
+	if _, ok := err.(*actions.InvalidEventError); ok {
+		return http.StatusBadRequest
+	}
+	if strings.HasPrefix(err.Error(), "WrongExpectedVersion") {
+		return http.StatusConflict
+	}
+	if strings.HasPrefix(err.Error(), "Forbidden") {
+		return http.StatusForbidden
+	}
+	if strings.HasPrefix(err.Error(), "NOT_FOUND") {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (me *httpHandler) serveStream(w http.ResponseWriter, r *http.Request) {
+	streamId, err := uuid.FromString(strings.TrimPrefix(r.URL.Path, "/streams/"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, errors.New("Wrong format for stream id: "+err.Error()))
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		me.appendToStream(w, r, streamId)
+	case "GET":
+		fmt.Println("-> GET stream", streamId.String())
+		version, err := me.handler.StreamVersion(streamId)
+		if err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		writePage(w, r, 1, uint64(version)+1, func(from uint64, count int) ([]*data.Event, uint64, error) {
+			events, first, err := me.handler.RetrieveStreamFrom(streamId, uint32(from), count)
+			return events, uint64(first), err
+		}, func(version uint64, event *HttpEvent) {
+			event.Version = uint32(version)
+		})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed: "+r.Method))
+	}
+}
+
+func (me *httpHandler) serveAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed: "+r.Method))
+		return
+	}
+	fmt.Println("-> GET all")
+	end, err := me.handler.EventCount()
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writePage(w, r, 0, end, func(from uint64, count int) ([]*data.Event, uint64, error) {
+		events, err := me.handler.RetrieveAllFrom(from, count)
+		return events, 0, err
+	}, func(position uint64, event *HttpEvent) {
+		event.Position = &position
+	})
+}
+
+func (me *httpHandler) appendToStream(w http.ResponseWriter, r *http.Request, streamId uuid.UUID) {
+	expectedVersion := actions.NO_EXPECTEDVERSION
+	if header := r.Header.Get(EXPECTED_VERSION_HEADER); header != "" {
+		version, err := strconv.ParseUint(header, 10, 32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("Wrong format for "+EXPECTED_VERSION_HEADER+": "+err.Error()))
+			return
+		}
+		expectedVersion = uint32(version)
+	}
+
+	var httpEvent HttpEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_BODY_SIZE)).Decode(&httpEvent); err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			writeError(w, http.StatusRequestEntityTooLarge, errors.New(fmt.Sprintf("Events can't be larger than %v bytes.", MAX_BODY_SIZE)))
+			return
+		}
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	payload, metadata, err := httpEvent.toPassthru()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	fmt.Println("-> POST stream", streamId.String(), expectedVersion)
+	event := data.Event{AggregateId: streamId, Payload: payload}
+	if metadata != nil {
+		event.Metadata = metadata
+	}
+	err = me.handler.AddEvent(event, expectedVersion)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJson(w, http.StatusCreated, struct{}{})
+}
+
+// writePage writes the page of the events numbered from first up to end,
+// excluded, selected by the from, count and direction parameters. Backward
+// pages from past the last event start at the last event. read reads up to
+// count events from a number on and returns them with the number of the first
+// event readers see, those of a stream before its last tombstone being
+// skipped. number sets the version or position of an event.
+func writePage(w http.ResponseWriter, r *http.Request, first uint64, end uint64, read func(uint64, int) ([]*data.Event, uint64, error), number func(uint64, *HttpEvent)) {
+	query := r.URL.Query()
+	backward := query.Get("direction") == "backward"
+	if direction := query.Get("direction"); direction != "" && direction != "forward" && !backward {
+		writeError(w, http.StatusBadRequest, errors.New("Unknown direction: "+direction))
+		return
+	}
+	count, err := parseParameter(query.Get("count"), DEFAULT_PAGE_SIZE)
+	if err != nil || count == 0 || count > MAX_PAGE_SIZE {
+		writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("count must be between 1 and %v", MAX_PAGE_SIZE)))
+		return
+	}
+	from, err := parseParameter(query.Get("from"), int(first))
+	if err != nil || uint64(from) < first {
+		writeError(w, http.StatusBadRequest, errors.New(fmt.Sprintf("from must be at least %v", first)))
+		return
+	}
+
+	start := uint64(from)
+	if backward {
+		last := uint64(from)
+		if query.Get("from") == "" || last >= end {
+			last = end - 1
+		}
+		start = first
+		if last+1 > first+uint64(count) {
+			start = last + 1 - uint64(count)
+		}
+		count = int(last + 1 - start)
+	}
+	events := make([]*data.Event, 0)
+	if start < end {
+		visible := uint64(0)
+		if events, visible, err = read(start, count); err != nil {
+			writeError(w, errorStatus(err), err)
+			return
+		}
+		if visible > first {
+			first = visible
+		}
+		if start < first {
+			start = first
+		}
+	}
+
+	page := &HttpPage{Events: make([]*HttpEvent, 0, len(events))}
+	for i, event := range events {
+		httpEvent, err := newHttpEvent(event)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		number(start+uint64(i), httpEvent)
+		page.Events = append(page.Events, httpEvent)
+	}
+	next := start + uint64(len(events))
+	if backward {
+		for i, j := 0, len(page.Events)-1; i < j; i, j = i+1, j-1 {
+			page.Events[i], page.Events[j] = page.Events[j], page.Events[i]
+		}
+		next = start - 1
+	}
+	if start < end && next >= first && next < end {
+		page.Next = &next
+	}
+	fmt.Println("<-", len(page.Events), "events")
+	writeJson(w, http.StatusOK, page)
+}
+
+func parseParameter(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	parsed, err := strconv.ParseUint(value, 10, 31)
+	return int(parsed), err
+}
+
+// SplitPassthru splits a value of the passthru serializer into its type and
+// data, as transports send them.
+func SplitPassthru(value interface{}) (string, []byte) {
+	content, _ := value.([]byte)
+	sep := bytes.IndexByte(content, ' ')
+	if sep == -1 {
+		return "", nil
+	}
+	return string(content[:sep]), content[sep+1:]
+}
+
+func newHttpEvent(event *data.Event) (*HttpEvent, error) {
+	creationTime := event.CreationTime
+	httpEvent := &HttpEvent{StreamId: event.AggregateId.String(), CreationTime: &creationTime}
+	typeId, payload := SplitPassthru(event.Payload)
+	metadataTypeId, metadata := SplitPassthru(event.Metadata)
+	httpEvent.TypeId = typeId
+	httpEvent.MetadataTypeId = metadataTypeId
+
+	if !json.Valid(payload) || (metadata != nil && !json.Valid(metadata)) {
+		httpEvent.Encoding = "base64"
+		payload = encodeBase64(payload)
+		if metadata != nil {
+			metadata = encodeBase64(metadata)
+		}
+	}
+	httpEvent.Payload = payload
+	httpEvent.Metadata = metadata
+	return httpEvent, nil
+}
+
+func encodeBase64(value []byte) []byte {
+	encoded, _ := json.Marshal(base64.StdEncoding.EncodeToString(value))
+	return encoded
+}
+
+func decodeBase64(value json.RawMessage) ([]byte, error) {
+	var encoded string
+	if err := json.Unmarshal(value, &encoded); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// toPassthru returns payload and metadata as the passthru serializer expects
+// them: the type, a space, then the data. Metadata is nil when absent.
+func (me *HttpEvent) toPassthru() (payload []byte, metadata []byte, err error) {
+	if me.TypeId == "" || strings.Contains(me.TypeId, " ") {
+		return nil, nil, errors.New("typeId must be set and can't contain spaces")
+	}
+	if me.MetadataTypeId == "" && len(me.Metadata) > 0 {
+		return nil, nil, errors.New("metadataTypeId must be set along metadata")
+	}
+	if strings.Contains(me.MetadataTypeId, " ") {
+		return nil, nil, errors.New("metadataTypeId can't contain spaces")
+	}
+
+	payloadData, metadataData := []byte(me.Payload), []byte(me.Metadata)
+	switch me.Encoding {
+	case "":
+	case "base64":
+		if payloadData, err = decodeBase64(me.Payload); err != nil {
+			return nil, nil, err
+		}
+		if len(me.Metadata) > 0 {
+			if metadataData, err = decodeBase64(me.Metadata); err != nil {
+				return nil, nil, err
+			}
+		}
+	default:
+		return nil, nil, errors.New("Unknown encoding: " + me.Encoding)
+	}
+
+	payload = append([]byte(me.TypeId+" "), payloadData...)
+	if me.MetadataTypeId != "" {
+		metadata = append([]byte(me.MetadataTypeId+" "), metadataData...)
+	}
+	return payload, metadata, nil
+}
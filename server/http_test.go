@@ -0,0 +1,186 @@
+package server
+
+import (
+	actions "../actions"
+	serializer "../serializer"
+	storage "../storage"
+	"encoding/json"
+	"errors"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newHttpTestServer() *httptest.Server {
+	handler := actions.NewActionsHandler(storage.NewInMemoryStorage(), serializer.NewPassthruSerializer())
+	return httptest.NewServer(NewHttpHandler(handler))
+}
+
+func postEvent(t *testing.T, url string, expectedVersion string, body string) *http.Response {
+	request, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	if expectedVersion != "" {
+		request.Header.Set(EXPECTED_VERSION_HEADER, expectedVersion)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	return response
+}
+
+func getPage(t *testing.T, url string) *HttpPage {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s failed with status %v", url, response.StatusCode)
+	}
+	var page HttpPage
+	if err = json.NewDecoder(response.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	return &page
+}
+
+func TestHttpAppendAndReadStream(t *testing.T) {
+	//Arrange
+	server := newHttpTestServer()
+	defer server.Close()
+	streamUrl := server.URL + "/streams/" + uuid.NewV4().String()
+
+	//Act
+	first := postEvent(t, streamUrl, "0", `{"typeId":"AnEvent","payload":{"A":1},"metadataTypeId":"Metadata","metadata":{"user":"me"}}`)
+	second := postEvent(t, streamUrl, "", `{"typeId":"AnEvent","payload":{"A":2}}`)
+	third := postEvent(t, streamUrl, "3", `{"typeId":"AnEvent","encoding":"base64","payload":"AAEC"}`)
+	fourth := postEvent(t, streamUrl, "2", `{"typeId":"AnEvent","encoding":"base64","payload":"AAEC"}`)
+
+	//Assert
+	if first.StatusCode != http.StatusCreated || second.StatusCode != http.StatusCreated || fourth.StatusCode != http.StatusCreated {
+		t.Errorf("POST failed with statuses %v, %v and %v", first.StatusCode, second.StatusCode, fourth.StatusCode)
+	}
+	if third.StatusCode != http.StatusConflict {
+		t.Errorf("POST with wrong expected version got status %v, expected %v", third.StatusCode, http.StatusConflict)
+	}
+
+	page := getPage(t, streamUrl+"?count=2")
+	if len(page.Events) != 2 || page.Next == nil || *page.Next != 3 {
+		t.Fatalf("GET stream failed. Got %+v", page)
+	}
+	event := page.Events[0]
+	if event.Version != 1 || event.TypeId != "AnEvent" || string(event.Payload) != `{"A":1}` || event.MetadataTypeId != "Metadata" || string(event.Metadata) != `{"user":"me"}` {
+		t.Errorf("GET stream failed. Got %+v", event)
+	}
+
+	page = getPage(t, streamUrl+"?direction=backward")
+	if len(page.Events) != 3 || page.Next != nil || page.Events[0].Version != 3 || page.Events[0].Encoding != "base64" || string(page.Events[0].Payload) != `"AAEC"` {
+		t.Errorf("GET stream backward failed. Got %+v", page)
+	}
+
+	page = getPage(t, streamUrl+"?direction=backward&from=10&count=2")
+	if len(page.Events) != 2 || page.Events[0].Version != 3 || page.Events[1].Version != 2 || page.Next == nil || *page.Next != 1 {
+		t.Errorf("GET stream backward from past the last event failed. Got %+v", page)
+	}
+	page = getPage(t, server.URL+"/streams/"+uuid.NewV4().String()+"?direction=backward")
+	if len(page.Events) != 0 || page.Next != nil {
+		t.Errorf("GET empty stream backward failed. Got %+v", page)
+	}
+}
+
+func TestHttpReadDeletedStream(t *testing.T) {
+	//Arrange
+	handler := actions.NewActionsHandler(storage.NewInMemoryStorage(), serializer.NewPassthruSerializer())
+	server := httptest.NewServer(NewHttpHandler(handler))
+	defer server.Close()
+	streamId := uuid.NewV4()
+	streamUrl := server.URL + "/streams/" + streamId.String()
+	postEvent(t, streamUrl, "", `{"typeId":"AnEvent","payload":1}`)
+	postEvent(t, streamUrl, "", `{"typeId":"AnEvent","payload":2}`)
+	handler.DeleteStream(streamId, actions.NO_EXPECTEDVERSION)
+	deleted := getPage(t, streamUrl)
+	postEvent(t, streamUrl, "", `{"typeId":"AnEvent","payload":4}`)
+	postEvent(t, streamUrl, "", `{"typeId":"AnEvent","payload":5}`)
+
+	//Act
+	page := getPage(t, streamUrl+"?count=1")
+	backwardPage := getPage(t, streamUrl+"?direction=backward")
+
+	//Assert
+	if len(deleted.Events) != 0 || deleted.Next != nil {
+		t.Errorf("GET deleted stream failed. Got %+v", deleted)
+	}
+	if len(page.Events) != 1 || page.Events[0].Version != 4 || string(page.Events[0].Payload) != "4" || page.Next == nil || *page.Next != 5 {
+		t.Errorf("GET stream after DeleteStream failed. Got %+v", page)
+	}
+	if len(backwardPage.Events) != 2 || backwardPage.Events[0].Version != 5 || backwardPage.Events[1].Version != 4 || backwardPage.Next != nil {
+		t.Errorf("GET stream backward after DeleteStream failed. Got %+v", backwardPage)
+	}
+}
+
+func TestHttpReadAll(t *testing.T) {
+	//Arrange
+	server := newHttpTestServer()
+	defer server.Close()
+	for i := 0; i < 3; i++ {
+		postEvent(t, server.URL+"/streams/"+uuid.NewV4().String(), "", `{"typeId":"AnEvent","payload":{}}`)
+	}
+
+	//Act
+	page := getPage(t, server.URL+"/all?from=1")
+	firstPage := getPage(t, server.URL+"/all?count=2")
+	backwardPage := getPage(t, server.URL+"/all?direction=backward&from=7&count=2")
+	endPage := getPage(t, server.URL+"/all?from=7")
+
+	//Assert
+	if len(page.Events) != 2 || *page.Events[0].Position != 1 || *page.Events[1].Position != 2 || page.Next != nil {
+		t.Errorf("GET all failed. Got %+v", page)
+	}
+	if len(firstPage.Events) != 2 || *firstPage.Events[1].Position != 1 || firstPage.Next == nil || *firstPage.Next != 2 {
+		t.Errorf("GET all first page failed. Got %+v", firstPage)
+	}
+	if len(backwardPage.Events) != 2 || *backwardPage.Events[0].Position != 2 || *backwardPage.Events[1].Position != 1 || backwardPage.Next == nil || *backwardPage.Next != 0 {
+		t.Errorf("GET all backward from past the last event failed. Got %+v", backwardPage)
+	}
+	if len(endPage.Events) != 0 || endPage.Next != nil {
+		t.Errorf("GET all from past the last event failed. Got %+v", endPage)
+	}
+}
+
+func TestHttpBadRequests(t *testing.T) {
+	server := newHttpTestServer()
+	defer server.Close()
+	streamUrl := server.URL + "/streams/" + uuid.NewV4().String()
+
+	for _, body := range []string{`not json`, `{"payload":{}}`, `{"typeId":"AnEvent","encoding":"rot13","payload":{}}`, `{"typeId":"$StreamDeleted","payload":{}}`} {
+		if response := postEvent(t, streamUrl, "", body); response.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST %s got status %v, expected %v", body, response.StatusCode, http.StatusBadRequest)
+		}
+	}
+	if response := postEvent(t, server.URL+"/streams/not-a-uuid", "", `{"typeId":"AnEvent","payload":{}}`); response.StatusCode != http.StatusNotFound {
+		t.Errorf("POST to a wrong stream id got status %v, expected %v", response.StatusCode, http.StatusNotFound)
+	}
+	tooLarge := `{"typeId":"AnEvent","payload":"` + strings.Repeat("a", MAX_BODY_SIZE) + `"}`
+	if response := postEvent(t, streamUrl, "", tooLarge); response.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST of a body larger than %v bytes got status %v, expected %v", MAX_BODY_SIZE, response.StatusCode, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestHttpErrorStatus(t *testing.T) {
+	statuses := map[error]int{
+		&actions.InvalidEventError{Reason: "Events must have a type."}: http.StatusBadRequest,
+		errors.New("Forbidden: anonymous may not write."):              http.StatusForbidden,
+		errors.New("WrongExpectedVersion: expected 1 got 2"):           http.StatusConflict,
+		errors.New("NOT_FOUND: stream " + uuid.NewV4().String()):       http.StatusNotFound,
+		errors.New("EOF"): http.StatusInternalServerError,
+	}
+
+	for err, expected := range statuses {
+		if status := errorStatus(err); status != expected {
+			t.Errorf("%q got status %v, expected %v", err, status, expected)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	actions "../actions"
+	"errors"
+	"sync"
+)
+
+var ErrTransportClosed = errors.New("Transport closed")
+
+type inProcessRequest struct {
+	principal string
+	message   [][]byte
+	reply     chan [][]byte
+}
+
+// InProcessTransport serves the frame-based protocol to callers of Request in
+// the same process, such as tests or programs embedding the store, without
+// ZeroMQ. Requests are dispatched concurrently.
+type InProcessTransport struct {
+	requests chan *inProcessRequest
+	lock     sync.Mutex
+	closed   bool
+	closing  chan struct{}
+	inFlight sync.WaitGroup
+}
+
+func NewInProcessTransport() *InProcessTransport {
+	return &InProcessTransport{requests: make(chan *inProcessRequest), closing: make(chan struct{})}
+}
+
+// Request sends the frames of an anonymous request and returns the frames of
+// its reply.
+func (me *InProcessTransport) Request(message [][]byte) ([][]byte, error) {
+	return me.RequestAs(actions.ANONYMOUS, message)
+}
+
+// RequestAs sends a request of principal, which the caller vouches for.
+func (me *InProcessTransport) RequestAs(principal string, message [][]byte) ([][]byte, error) {
+	me.lock.Lock()
+	if me.closed {
+		me.lock.Unlock()
+		return nil, ErrTransportClosed
+	}
+	me.inFlight.Add(1)
+	me.lock.Unlock()
+	defer me.inFlight.Done()
+
+	request := &inProcessRequest{principal, message, make(chan [][]byte, 1)}
+	select {
+	case me.requests <- request:
+	case <-me.closing:
+		return nil, ErrTransportClosed
+	}
+	return <-request.reply, nil
+}
+
+func (me *InProcessTransport) Serve(server *Server) error {
+	for {
+		select {
+		case request := <-me.requests:
+			go func() {
+				request.reply <- server.DispatchAs(request.principal, request.message)
+			}()
+		case <-me.closing:
+			return nil
+		}
+	}
+}
+
+// Close refuses new requests and returns once those in flight are answered.
+func (me *InProcessTransport) Close() error {
+	me.lock.Lock()
+	if !me.closed {
+		me.closed = true
+		close(me.closing)
+	}
+	me.lock.Unlock()
+	me.inFlight.Wait()
+	return nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+)
+
+// BadRequestError is replied to requests that don't have the frames their
+// command expects, as "Error: BadRequest: {reason}".
+type BadRequestError struct {
+	Reason string
+}
+
+func (me *BadRequestError) Error() string {
+	return "BadRequest: " + me.Reason
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &BadRequestError{fmt.Sprintf(format, args...)}
+}
+
+// requestShape is how many frames the requests of a command have and, when
+// they have one, the size of their args frame. ANY_SIZE leaves a bound or the
+// size unchecked.
+type requestShape struct {
+	minFrames int
+	maxFrames int
+	argsSize  int
+}
+
+const ANY_SIZE = -1
+
+var requestShapes = map[string]requestShape{
+	"Hello":              {1, ANY_SIZE, ANY_SIZE},
+	"Ping":               {1, 1, ANY_SIZE},
+	"AddEvent":           {3, 3, UUID_SIZE},
+	"AddEvent_v2":        {4, 4, UUID_SIZE + 4},
+	"ReadStream":         {2, 2, UUID_SIZE},
+	"ReadStream_v2":      {2, 2, UUID_SIZE},
+	"ReadAll":            {1, 1, ANY_SIZE},
+	"ReadAll_v2":         {1, 1, ANY_SIZE},
+	"RebuildTypeIndexes": {1, 1, ANY_SIZE},
+	"Backup":             {2, 2, ANY_SIZE},
+	"Shutdown":           {1, 1, ANY_SIZE},
+}
+
+// decodedRequest is a decoded request of the frame-based protocol. Fields its
+// command doesn't take are left empty.
+type decodedRequest struct {
+	command         string
+	streamId        uuid.UUID
+	expectedVersion uint32
+	payload         []byte
+	metadata        []byte
+	target          string
+	versions        [][]byte
+}
+
+// decodeRequest checks that a message has the frames of its command and
+// decodes them. Dispatch only gets to index frames through it.
+func decodeRequest(message [][]byte) (*decodedRequest, error) {
+	if len(message) == 0 {
+		return nil, badRequest("Empty message.")
+	}
+	command := string(message[COMMAND_FRAME])
+	shape, ok := requestShapes[command]
+	if !ok {
+		return nil, errors.New("Unknown command: " + command)
+	}
+	if len(message) < shape.minFrames || (shape.maxFrames != ANY_SIZE && len(message) > shape.maxFrames) {
+		return nil, badRequest("%v takes %v frames, got %v.", command, shapeFrames(shape), len(message))
+	}
+	if shape.argsSize != ANY_SIZE && len(message[ARGS_FRAME]) != shape.argsSize {
+		return nil, badRequest("%v takes %v bytes of arguments, got %v.", command, shape.argsSize, len(message[ARGS_FRAME]))
+	}
+
+	request := &decodedRequest{command: command}
+	switch command {
+	case "Hello":
+		request.versions = message[1:]
+	case "AddEvent":
+		request.streamId, _ = uuid.FromBytes(message[ARGS_FRAME])
+		request.payload = message[PAYLOAD_FRAME]
+	case "AddEvent_v2":
+		request.streamId, _ = uuid.FromBytes(message[ARGS_FRAME][:UUID_SIZE])
+		request.expectedVersion = binary.LittleEndian.Uint32(message[ARGS_FRAME][UUID_SIZE:])
+		request.payload = message[PAYLOAD_FRAME]
+		request.metadata = message[METADATA_FRAME]
+	case "ReadStream", "ReadStream_v2":
+		request.streamId, _ = uuid.FromBytes(message[ARGS_FRAME])
+	case "Backup":
+		request.target = string(message[ARGS_FRAME])
+		if request.target == "" {
+			return nil, badRequest("Backup takes a target.")
+		}
+	}
+	if (command == "AddEvent" || command == "AddEvent_v2") && len(request.payload) == 0 {
+		return nil, badRequest("%v takes a payload.", command)
+	}
+	return request, nil
+}
+
+func shapeFrames(shape requestShape) string {
+	switch {
+	case shape.maxFrames == ANY_SIZE:
+		return fmt.Sprintf("at least %v", shape.minFrames)
+	case shape.minFrames == shape.maxFrames:
+		return fmt.Sprintf("%v", shape.minFrames)
+	}
+	return fmt.Sprintf("%v to %v", shape.minFrames, shape.maxFrames)
+}
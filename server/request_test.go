@@ -0,0 +1,96 @@
+package server
+
+import (
+	"github.com/satori/go.uuid"
+	"strings"
+	"testing"
+)
+
+func frames(strs ...string) [][]byte {
+	message := make([][]byte, len(strs))
+	for i, str := range strs {
+		message[i] = []byte(str)
+	}
+	return message
+}
+
+func TestDecodeRequestRejectsMalformedMessages(t *testing.T) {
+	streamId := string(uuid.NewV4().Bytes())
+	malformed := map[string][][]byte{
+		"no frames":                {},
+		"AddEvent without payload": frames("AddEvent", streamId),
+		"AddEvent_v2 short args":   frames("AddEvent_v2", streamId, "AnEvent 1", ""),
+		"AddEvent_v2 no metadata":  frames("AddEvent_v2", streamId+"\x00\x00\x00\x00", "AnEvent 1"),
+		"AddEvent_v2 empty":        frames("AddEvent_v2", streamId+"\x00\x00\x00\x00", "", ""),
+		"ReadStream without id":    frames("ReadStream"),
+		"ReadStream_v2 long id":    frames("ReadStream_v2", streamId+"x"),
+		"ReadAll with args":        frames("ReadAll", "x"),
+		"Backup without target":    frames("Backup", ""),
+		"Shutdown with args":       frames("Shutdown", "now"),
+	}
+
+	for name, message := range malformed {
+		request, err := decodeRequest(message)
+
+		if _, ok := err.(*BadRequestError); !ok {
+			t.Errorf("%v: decoded %+v with error %v", name, request, err)
+		}
+	}
+}
+
+func TestDecodeRequestDecodesAddEvent(t *testing.T) {
+	streamId := uuid.NewV4()
+
+	request, err := decodeRequest(addEventRequest(streamId, 3, "AnEvent 1"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.streamId != streamId || request.expectedVersion != 3 || string(request.payload) != "AnEvent 1" || len(request.metadata) != 0 {
+		t.Errorf("Decoded %+v", request)
+	}
+}
+
+func TestMalformedRequestsGetBadRequestReplies(t *testing.T) {
+	transport := NewInProcessTransport()
+	server := newTestServer()
+	runServer(server, transport)
+	defer server.Shutdown()
+
+	reply := request(t, transport, []byte("AddEvent_v2"), []byte{1, 2, 3})
+
+	if len(reply) != 1 || !strings.HasPrefix(reply[0], "Error: BadRequest: ") {
+		t.Errorf("Malformed AddEvent_v2 replied %q", reply)
+	}
+}
+
+// FuzzDispatch checks that no message crashes the server: each gets a reply
+// starting with a status or an event count. The first frameCount of the
+// command, args, payload and metadata frames make the message.
+func FuzzDispatch(f *testing.F) {
+	streamId := uuid.NewV4().Bytes()
+	args := append(append([]byte{}, streamId...), 0, 0, 0, 0)
+	f.Add(uint8(4), "AddEvent_v2", args, []byte("AnEvent 1"), []byte("Metadata 1"))
+	f.Add(uint8(3), "AddEvent", streamId, []byte("AnEvent 1"), []byte{})
+	f.Add(uint8(2), "ReadStream_v2", streamId, []byte{}, []byte{})
+	f.Add(uint8(1), "ReadAll", []byte{}, []byte{}, []byte{})
+	f.Add(uint8(3), "Hello", []byte("1"), []byte("2"), []byte{})
+	server := newTestServer()
+
+	f.Fuzz(func(t *testing.T, frameCount uint8, command string, args []byte, payload []byte, metadata []byte) {
+		switch command {
+		case "Shutdown", "Backup", "RebuildTypeIndexes":
+			return
+		}
+		message := [][]byte{[]byte(command), args, payload, metadata}
+		if int(frameCount) < len(message) {
+			message = message[:frameCount]
+		}
+
+		reply := server.Dispatch(message)
+
+		if len(reply) == 0 || len(reply[0]) == 0 {
+			t.Errorf("%q got reply %q", message, reply)
+		}
+	})
+}
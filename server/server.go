@@ -0,0 +1,376 @@
+package server
+
+import (
+	actions "../actions"
+	data "../data"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const UUID_SIZE = 16
+const COMMAND_FRAME = 0
+const ARGS_FRAME = 1
+const PAYLOAD_FRAME = 2
+const METADATA_FRAME = 3
+
+// PROTOCOL_VERSIONS are the versions of the frame-based protocol the server
+// speaks: 1 has AddEvent, ReadStream and ReadAll, 2 adds expected versions and
+// metadata with AddEvent_v2, ReadStream_v2 and ReadAll_v2. In every version,
+// AddEvent fails for events without a type or with a type starting with $,
+// which are reserved for events the store writes itself, like tombstones;
+// servers before DeleteStream accepted them.
+var PROTOCOL_VERSIONS = []int{1, 2}
+
+// COMMANDS are the commands of the frame-based protocol.
+var COMMANDS = []string{"Hello", "Ping", "AddEvent", "AddEvent_v2", "ReadStream", "ReadStream_v2", "ReadAll", "ReadAll_v2", "RebuildTypeIndexes", "Backup", "Shutdown"}
+
+// ServerInfo is what the Hello command replies with, as JSON. ProtocolVersion
+// is the highest version both the client and the server speak, when the client
+// sends the versions it speaks.
+type ServerInfo struct {
+	ServerVersion    string   `json:"serverVersion"`
+	ProtocolVersions []int    `json:"protocolVersions"`
+	ProtocolVersion  int      `json:"protocolVersion,omitempty"`
+	Storage          string   `json:"storage"`
+	Commands         []string `json:"commands"`
+	Features         []string `json:"features"`
+}
+
+// SHUTDOWN_TIMEOUT bounds how long transports wait for requests in flight,
+// such as live feeds, when the server shuts down.
+const SHUTDOWN_TIMEOUT = 5 * time.Second
+
+// Transport receives requests for a Server, e.g. from a ZeroMQ socket. Serve
+// blocks until Close is called or it fails; Close returns once requests in
+// flight are answered. The ZeroMQ and gRPC transports are in the zmqtransport
+// and grpctransport packages, so this one builds without cgo or gRPC.
+type Transport interface {
+	Serve(server *Server) error
+	Close() error
+}
+
+// Server answers the requests of its transports with a shared handler. The
+// frame-based protocol of the ZeroMQ and in-process transports goes through
+// Dispatch; the HTTP and gRPC transports map their own requests onto the
+// handler.
+//
+// Info describes the server to clients and must be completed before Run, as
+// must BackupDir, the directory Backup targets are relative to. Backup is
+// refused without it.
+type Server struct {
+	Info         ServerInfo
+	BackupDir    string
+	handler      actions.Handler
+	lock         sync.Mutex
+	transports   []Transport
+	stopped      bool
+	inFlight     sync.WaitGroup
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	rebuilding   int32
+	backingUp    int32
+}
+
+// ErrServerStopped is the error of the requests a server refuses once Run
+// returned.
+var ErrServerStopped = errors.New("Server stopped")
+
+func NewServer(handler actions.Handler) *Server {
+	info := ServerInfo{ProtocolVersions: PROTOCOL_VERSIONS, Commands: COMMANDS, Features: make([]string, 0)}
+	return &Server{Info: info, handler: handler, shutdown: make(chan struct{})}
+}
+
+func (me *Server) Handler() actions.Handler {
+	return me.handler
+}
+
+// Run serves every transport until Shutdown is called or a transport fails,
+// then closes them all and returns the error of the first that failed. It
+// returns once the requests and background tasks in flight are done, so that
+// the storage can be closed.
+func (me *Server) Run(transports ...Transport) error {
+	results := make(chan error, len(transports))
+	me.lock.Lock()
+	for _, transport := range transports {
+		me.transports = append(me.transports, transport)
+		go func(transport Transport) {
+			results <- transport.Serve(me)
+		}(transport)
+	}
+	me.lock.Unlock()
+
+	var err error
+	remaining := len(transports)
+	select {
+	case <-me.shutdown:
+	case err = <-results:
+		remaining--
+	}
+	me.Destroy()
+	for ; remaining > 0; remaining-- {
+		if serveErr := <-results; err == nil {
+			err = serveErr
+		}
+	}
+
+	me.lock.Lock()
+	me.stopped = true
+	me.lock.Unlock()
+	me.inFlight.Wait()
+	return err
+}
+
+// Begin counts a request in flight, which Run waits for, or fails with
+// ErrServerStopped once Run is done. Transports running requests on Handler
+// call it first, then End once the request is answered; Dispatch does both.
+func (me *Server) Begin() error {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	if me.stopped {
+		return ErrServerStopped
+	}
+	me.inFlight.Add(1)
+	return nil
+}
+
+// End tells that a request counted by Begin is answered.
+func (me *Server) End() {
+	me.inFlight.Done()
+}
+
+// Shutdown makes Run close the transports and return.
+func (me *Server) Shutdown() {
+	me.shutdownOnce.Do(func() {
+		close(me.shutdown)
+	})
+}
+
+// Destroy closes the transports of the server.
+func (me *Server) Destroy() {
+	me.lock.Lock()
+	transports := me.transports
+	me.transports = nil
+	me.lock.Unlock()
+
+	for _, transport := range transports {
+		if err := transport.Close(); err != nil {
+			fmt.Println("Closing transport failed:", err)
+		}
+	}
+}
+
+func reply(frames ...string) [][]byte {
+	reply := make([][]byte, len(frames))
+	for i, frame := range frames {
+		reply[i] = []byte(frame)
+	}
+	return reply
+}
+
+func errorReply(err error) [][]byte {
+	fmt.Println(err)
+	return reply(fmt.Sprintf("Error: %v", err))
+}
+
+// Dispatch runs the command of an anonymous request of the frame-based
+// protocol and returns the frames of its reply.
+func (me *Server) Dispatch(message [][]byte) [][]byte {
+	return me.DispatchAs(actions.ANONYMOUS, message)
+}
+
+// DispatchAs runs the command of a request of principal, within the limits of
+// the ACL of the handler.
+func (me *Server) DispatchAs(principal string, message [][]byte) [][]byte {
+	if err := me.Begin(); err != nil {
+		return errorReply(err)
+	}
+	defer me.End()
+
+	handler := me.handler.As(principal)
+	request, err := decodeRequest(message)
+	if err != nil {
+		return errorReply(err)
+	}
+	command := request.command
+	switch command {
+	case "Hello":
+		// "Hello" {protocol version}* - replies "Ok" {ServerInfo as JSON}
+		fmt.Println("->", command)
+		info := me.Info
+		if len(request.versions) > 0 {
+			info.ProtocolVersion = negotiateVersion(request.versions)
+			if info.ProtocolVersion == 0 {
+				return errorReply(errors.New(fmt.Sprintf("No common protocol version, the server speaks %v.", PROTOCOL_VERSIONS)))
+			}
+		}
+		content, err := json.Marshal(&info)
+		if err != nil {
+			return errorReply(err)
+		}
+		return [][]byte{[]byte("Ok"), content}
+	case "Ping":
+		return reply("Ok")
+	case "AddEvent":
+		// v1 - "AddEvent" [AggregateId] {payload}
+		fmt.Println("->", command, request.streamId.String())
+		err = handler.AddEvent(data.Event{AggregateId: request.streamId, Payload: request.payload, Metadata: nil}, actions.NO_EXPECTEDVERSION)
+		if err != nil {
+			return errorReply(err)
+		}
+		return reply("Ok")
+	case "AddEvent_v2":
+		// v2 - "AddEvent" 16:AggregateId,4:expectedVersion {payload} {metadata}
+		fmt.Println("->", command, request.streamId.String(), request.expectedVersion)
+		// An empty metadata frame means the event has no metadata.
+		var metadata interface{}
+		if len(request.metadata) > 0 {
+			metadata = request.metadata
+		}
+		err = handler.AddEvent(data.Event{AggregateId: request.streamId, Payload: request.payload, Metadata: metadata}, request.expectedVersion)
+		if err != nil {
+			return errorReply(err)
+		}
+		return reply("Ok")
+	case "ReadStream", "ReadStream_v2":
+		fmt.Println("->", command, request.streamId.String())
+		events, err := handler.RetrieveFor(request.streamId)
+		if err != nil {
+			return errorReply(err)
+		}
+		return eventsReply(events, command == "ReadStream_v2")
+	case "ReadAll", "ReadAll_v2":
+		fmt.Println("->", command)
+		events, err := handler.RetrieveAll()
+		if err != nil {
+			return errorReply(err)
+		}
+		return eventsReply(events, command == "ReadAll_v2")
+	case "RebuildTypeIndexes":
+		// Writes go on during the rebuild, so it runs in the background. A
+		// single rebuild runs at a time.
+		fmt.Println("->", command)
+		if err := handler.Authorize(actions.REBUILD, uuid.Nil, ""); err != nil {
+			return errorReply(err)
+		}
+		started := me.startBackground(&me.rebuilding, func() {
+			if err := handler.RebuildTypeIndexes(); err != nil {
+				fmt.Println("Rebuilding type indexes failed:", err)
+			}
+		})
+		if !started {
+			return errorReply(errors.New("Type indexes are already being rebuilt."))
+		}
+		return reply("Ok")
+	case "Backup":
+		// "Backup" {target} - replies "Ok" {position} once the backup is
+		// done, with the global position it was frozen at as decimal text.
+		// Writes go on during the backup. A single backup runs at a time.
+		fmt.Println("->", command, request.target)
+		if err := handler.Authorize(actions.BACKUP, uuid.Nil, ""); err != nil {
+			return errorReply(err)
+		}
+		target, err := me.backupPath(request.target)
+		if err != nil {
+			return errorReply(err)
+		}
+		if !atomic.CompareAndSwapInt32(&me.backingUp, 0, 1) {
+			return errorReply(errors.New("A backup is already running."))
+		}
+		defer atomic.StoreInt32(&me.backingUp, 0)
+		position, err := handler.Backup(target)
+		if err != nil {
+			fmt.Println("Backup to", target, "failed:", err)
+			return errorReply(err)
+		}
+		fmt.Println("Backed up", position, "events to", target)
+		return [][]byte{[]byte("Ok"), []byte(strconv.FormatUint(position, 10))}
+	case "Shutdown":
+		// Replies "Ok", then the server closes its transports.
+		fmt.Println("->", command)
+		if err := handler.Authorize(actions.SHUTDOWN, uuid.Nil, ""); err != nil {
+			return errorReply(err)
+		}
+		me.Shutdown()
+		return reply("Ok")
+	}
+	return errorReply(errors.New("Unknown command: " + command))
+}
+
+// startBackground runs task in the background, unless the previous task
+// flagged by running is still going on, and tells whether it started it. The
+// task is counted in flight like the request starting it, for Run to wait.
+func (me *Server) startBackground(running *int32, task func()) bool {
+	if !atomic.CompareAndSwapInt32(running, 0, 1) {
+		return false
+	}
+	me.inFlight.Add(1)
+	go func() {
+		defer me.inFlight.Done()
+		defer atomic.StoreInt32(running, 0)
+		task()
+	}()
+	return true
+}
+
+// backupPath returns where a Backup target goes in the backup directory.
+// Targets can't be absolute or get out of it with "..".
+func (me *Server) backupPath(target string) (string, error) {
+	if me.BackupDir == "" {
+		return "", errors.New("Backup is disabled, the server has no backup directory.")
+	}
+	elements := strings.FieldsFunc(target, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+	escapes := strings.HasPrefix(target, "/") || strings.HasPrefix(target, "\\") || (len(target) > 1 && target[1] == ':')
+	for _, element := range elements {
+		escapes = escapes || element == ".."
+	}
+	if escapes || len(elements) == 0 {
+		return "", errors.New("Backup targets must be relative to the backup directory, without \"..\": " + target)
+	}
+	return filepath.Join(append([]string{me.BackupDir}, elements...)...), nil
+}
+
+// negotiateVersion returns the highest of the versions that the server speaks,
+// 0 if it speaks none of them.
+func negotiateVersion(versions [][]byte) int {
+	negotiated := 0
+	for _, frame := range versions {
+		version, err := strconv.Atoi(string(frame))
+		if err != nil {
+			continue
+		}
+		for _, supported := range PROTOCOL_VERSIONS {
+			if version == supported && version > negotiated {
+				negotiated = version
+			}
+		}
+	}
+	return negotiated
+}
+
+// eventsReply holds the event count then, for each event, its payload and with
+// v2 its metadata.
+func eventsReply(events []*data.Event, v2 bool) [][]byte {
+	reply := [][]byte{[]byte(fmt.Sprintf("%v", len(events)))}
+	for _, event := range events {
+		payload, _ := event.Payload.([]byte)
+		reply = append(reply, payload)
+		if v2 {
+			metadata, _ := event.Metadata.([]byte)
+			reply = append(reply, metadata)
+		}
+	}
+	if len(events) > 0 {
+		fmt.Println("<-", len(events), "events")
+	}
+	return reply
+}
@@ -0,0 +1,328 @@
+package server
+
+import (
+	actions "../actions"
+	serializer "../serializer"
+	storage "../storage"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer() *Server {
+	return NewServer(actions.NewActionsHandler(storage.NewInMemoryStorage(), serializer.NewPassthruSerializer()))
+}
+
+func addEventRequest(streamId uuid.UUID, expectedVersion uint32, payload string) [][]byte {
+	args := make([]byte, UUID_SIZE+4)
+	copy(args, streamId.Bytes())
+	binary.LittleEndian.PutUint32(args[UUID_SIZE:], expectedVersion)
+	return [][]byte{[]byte("AddEvent_v2"), args, []byte(payload), []byte{}}
+}
+
+func request(t *testing.T, transport *InProcessTransport, frames ...[]byte) []string {
+	reply, err := transport.Request(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strs := make([]string, len(reply))
+	for i, frame := range reply {
+		strs[i] = string(frame)
+	}
+	return strs
+}
+
+func runServer(server *Server, transports ...Transport) chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- server.Run(transports...)
+	}()
+	return result
+}
+
+func TestTransportsShareTheDispatcher(t *testing.T) {
+	//Arrange
+	writer, reader := NewInProcessTransport(), NewInProcessTransport()
+	server := newTestServer()
+	result := runServer(server, writer, reader)
+	streamId := uuid.NewV4()
+
+	//Act
+	added := request(t, writer, addEventRequest(streamId, 0, "AnEvent 1")...)
+	read := request(t, reader, []byte("ReadStream_v2"), streamId.Bytes())
+	unknown := request(t, reader, []byte("Unknown"))
+	shutdown := request(t, writer, []byte("Shutdown"))
+	server.Shutdown()
+	err := <-result
+	_, closedErr := reader.Request([][]byte{[]byte("ReadAll_v2")})
+
+	//Assert
+	if len(added) != 1 || added[0] != "Ok" {
+		t.Errorf("AddEvent_v2 replied %q", added)
+	}
+	if len(read) != 3 || read[0] != "1" || read[1] != "AnEvent 1" || read[2] != "" {
+		t.Errorf("ReadStream_v2 replied %q", read)
+	}
+	if len(unknown) != 1 || unknown[0] != "Error: Unknown command: Unknown" {
+		t.Errorf("Unknown command replied %q", unknown)
+	}
+	if len(shutdown) != 1 || shutdown[0] != "Error: Forbidden: Shutdown requires an ACL granting admin." {
+		t.Errorf("Shutdown without ACL replied %q", shutdown)
+	}
+	if err != nil {
+		t.Errorf("Run returned %v", err)
+	}
+	if closedErr != ErrTransportClosed {
+		t.Errorf("Request after shutdown failed with %v", closedErr)
+	}
+}
+
+func TestClosingHttpTransportEndsFeeds(t *testing.T) {
+	//Arrange
+	transport, err := NewHttpTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer()
+	result := runServer(server, transport)
+	response, err := http.Get("http://" + transport.listener.Addr().String() + "/feed/all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	//Act
+	started := time.Now()
+	server.Shutdown()
+	err = <-result
+
+	//Assert
+	if err != nil {
+		t.Errorf("Run returned %v", err)
+	}
+	if elapsed := time.Since(started); elapsed >= SHUTDOWN_TIMEOUT {
+		t.Errorf("Shutdown took %v, the feed wasn't ended", elapsed)
+	}
+}
+
+func TestHelloDescribesTheServer(t *testing.T) {
+	//Arrange
+	transport := NewInProcessTransport()
+	server := newTestServer()
+	server.Info.ServerVersion = "1.2.3"
+	server.Info.Storage = "memory"
+	server.Info.Features = []string{"backup"}
+	runServer(server, transport)
+	defer server.Shutdown()
+
+	//Act
+	hello := request(t, transport, []byte("Hello"), []byte("1"), []byte("2"), []byte("3"))
+	unsupported := request(t, transport, []byte("Hello"), []byte("3"))
+	ping := request(t, transport, []byte("Ping"))
+
+	//Assert
+	if len(hello) != 2 || hello[0] != "Ok" {
+		t.Fatalf("Hello replied %q", hello)
+	}
+	info := ServerInfo{}
+	if err := json.Unmarshal([]byte(hello[1]), &info); err != nil {
+		t.Fatal(err)
+	}
+	expected := ServerInfo{"1.2.3", PROTOCOL_VERSIONS, 2, "memory", COMMANDS, []string{"backup"}}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("Hello replied %+v, expected %+v", info, expected)
+	}
+	if len(unsupported) != 1 || unsupported[0] != "Error: No common protocol version, the server speaks [1 2]." {
+		t.Errorf("Hello with an unsupported version replied %q", unsupported)
+	}
+	if len(ping) != 1 || ping[0] != "Ok" {
+		t.Errorf("Ping replied %q", ping)
+	}
+}
+
+func TestRequestsRunAsTheirPrincipal(t *testing.T) {
+	//Arrange
+	acl, _ := actions.NewACL([]actions.AclRule{
+		{Principals: []string{"*"}, Operations: []string{actions.READ}},
+		{Principals: []string{"admin"}, Operations: []string{actions.WRITE, actions.ADMIN}},
+	})
+	handler := actions.NewActionsHandler(storage.NewInMemoryStorage(), serializer.NewPassthruSerializer())
+	handler.SetACL(acl)
+	transport := NewInProcessTransport()
+	result := runServer(NewServer(handler), transport)
+	streamId := uuid.NewV4()
+
+	//Act
+	anonymousAdd := request(t, transport, addEventRequest(streamId, 0, "AnEvent 1")...)
+	adminAdd, _ := transport.RequestAs("admin", addEventRequest(streamId, 0, "AnEvent 1"))
+	read := request(t, transport, []byte("ReadStream_v2"), streamId.Bytes())
+	anonymousShutdown := request(t, transport, []byte("Shutdown"))
+	adminShutdown, _ := transport.RequestAs("admin", [][]byte{[]byte("Shutdown")})
+	err := <-result
+
+	//Assert
+	if len(anonymousAdd) != 1 || anonymousAdd[0] != "Error: Forbidden: anonymous may not write on stream "+streamId.String()+" of type AnEvent." {
+		t.Errorf("Anonymous AddEvent_v2 replied %q", anonymousAdd)
+	}
+	if len(adminAdd) != 1 || string(adminAdd[0]) != "Ok" || len(read) != 3 {
+		t.Errorf("Admin AddEvent_v2 replied %q, then ReadStream_v2 %q", adminAdd, read)
+	}
+	if len(anonymousShutdown) != 1 || anonymousShutdown[0] != "Error: Forbidden: anonymous may not shutdown." {
+		t.Errorf("Anonymous Shutdown replied %q", anonymousShutdown)
+	}
+	if len(adminShutdown) != 1 || string(adminShutdown[0]) != "Ok" || err != nil {
+		t.Errorf("Admin Shutdown replied %q and Run returned %v", adminShutdown, err)
+	}
+}
+
+type blockingRebuildStorage struct {
+	storage.Storage
+	started chan bool
+	release chan bool
+}
+
+func (me *blockingRebuildStorage) RebuildTypeIndexes() error {
+	me.started <- true
+	<-me.release
+	return nil
+}
+
+func TestOneTypeIndexRebuildRunsAtATime(t *testing.T) {
+	//Arrange
+	acl, _ := actions.NewACL([]actions.AclRule{{Principals: []string{"admin"}, Operations: []string{actions.ADMIN}}})
+	rebuildStorage := &blockingRebuildStorage{storage.NewInMemoryStorage(), make(chan bool, 1), make(chan bool)}
+	handler := actions.NewActionsHandler(rebuildStorage, serializer.NewPassthruSerializer())
+	server := NewServer(handler)
+	rebuild := [][]byte{[]byte("RebuildTypeIndexes")}
+
+	//Act
+	withoutACL := newTestServer().Dispatch(rebuild)
+	handler.SetACL(acl)
+	anonymous := server.Dispatch(rebuild)
+	first := server.DispatchAs("admin", rebuild)
+	<-rebuildStorage.started
+	second := server.DispatchAs("admin", rebuild)
+	rebuildStorage.release <- true
+	for string(server.DispatchAs("admin", rebuild)[0]) != "Ok" {
+		time.Sleep(time.Millisecond)
+	}
+	<-rebuildStorage.started
+	rebuildStorage.release <- true
+
+	//Assert
+	if len(withoutACL) != 1 || string(withoutACL[0]) != "Error: Forbidden: Rebuild requires an ACL granting admin." {
+		t.Errorf("RebuildTypeIndexes without ACL replied %q", withoutACL)
+	}
+	if len(anonymous) != 1 || string(anonymous[0]) != "Error: Forbidden: anonymous may not rebuild." {
+		t.Errorf("Anonymous RebuildTypeIndexes replied %q", anonymous)
+	}
+	if len(first) != 1 || string(first[0]) != "Ok" {
+		t.Errorf("RebuildTypeIndexes replied %q", first)
+	}
+	if len(second) != 1 || string(second[0]) != "Error: Type indexes are already being rebuilt." {
+		t.Errorf("RebuildTypeIndexes during a rebuild replied %q", second)
+	}
+}
+
+func TestRunWaitsForBackgroundTasks(t *testing.T) {
+	//Arrange
+	acl, _ := actions.NewACL([]actions.AclRule{{Principals: []string{"admin"}, Operations: []string{actions.ADMIN}}})
+	rebuildStorage := &blockingRebuildStorage{storage.NewInMemoryStorage(), make(chan bool, 1), make(chan bool)}
+	handler := actions.NewActionsHandler(rebuildStorage, serializer.NewPassthruSerializer())
+	handler.SetACL(acl)
+	server := NewServer(handler)
+	result := runServer(server, NewInProcessTransport())
+	server.DispatchAs("admin", [][]byte{[]byte("RebuildTypeIndexes")})
+	<-rebuildStorage.started
+
+	//Act
+	server.Shutdown()
+	var returnedEarly bool
+	select {
+	case <-result:
+		returnedEarly = true
+	case <-time.After(50 * time.Millisecond):
+	}
+	rebuildStorage.release <- true
+	err := <-result
+	afterRun := server.Dispatch([][]byte{[]byte("Ping")})
+
+	//Assert
+	if returnedEarly {
+		t.Error("Run returned before the type index rebuild was done")
+	}
+	if err != nil {
+		t.Errorf("Run returned %v", err)
+	}
+	if len(afterRun) != 1 || string(afterRun[0]) != "Error: "+ErrServerStopped.Error() {
+		t.Errorf("Ping after Run replied %q", afterRun)
+	}
+}
+
+type blockingBackupStorage struct {
+	storage.Storage
+	started chan bool
+	release chan bool
+}
+
+func (me *blockingBackupStorage) Backup(target storage.BackupTarget) (uint64, error) {
+	me.started <- true
+	<-me.release
+	return 42, nil
+}
+
+func TestBackupsRunOneAtATimeInTheBackupDirectory(t *testing.T) {
+	//Arrange
+	backupDir := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(backupDir)
+	acl, _ := actions.NewACL([]actions.AclRule{{Principals: []string{"admin"}, Operations: []string{actions.ADMIN}}})
+	backupStorage := &blockingBackupStorage{storage.NewInMemoryStorage(), make(chan bool, 1), make(chan bool)}
+	handler := actions.NewActionsHandler(backupStorage, serializer.NewPassthruSerializer())
+	server := NewServer(handler)
+	backup := func(server *Server, target string) string {
+		return string(bytes.Join(server.DispatchAs("admin", [][]byte{[]byte("Backup"), []byte(target)}), []byte(" ")))
+	}
+
+	//Act
+	withoutACL := backup(server, "nightly")
+	handler.SetACL(acl)
+	withoutDir := backup(server, "nightly")
+	server.BackupDir = backupDir
+	escaping := []string{backup(server, "/tmp/nightly"), backup(server, "../nightly"), backup(server, "a/../../nightly"), backup(server, "C:\\nightly")}
+	replies := make(chan string)
+	go func() {
+		replies <- backup(server, "nightly")
+	}()
+	<-backupStorage.started
+	_, statErr := os.Stat(path.Join(backupDir, "nightly"))
+	second := backup(server, "other")
+	backupStorage.release <- true
+	first := <-replies
+
+	//Assert
+	if withoutACL != "Error: Forbidden: Backup requires an ACL granting admin." {
+		t.Errorf("Backup without ACL replied %q", withoutACL)
+	}
+	if withoutDir != "Error: Backup is disabled, the server has no backup directory." {
+		t.Errorf("Backup without backup directory replied %q", withoutDir)
+	}
+	for _, reply := range escaping {
+		if !strings.HasPrefix(reply, "Error: Backup targets must be relative to the backup directory") {
+			t.Errorf("Backup out of the backup directory replied %q", reply)
+		}
+	}
+	if first != "Ok 42" || statErr != nil {
+		t.Errorf("Backup replied %q, the target is missing: %v", first, statErr)
+	}
+	if second != "Error: A backup is already running." {
+		t.Errorf("Backup during a backup replied %q", second)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	actions "../actions"
+	data "../data"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const LAST_EVENT_ID_HEADER = "Last-Event-ID"
+
+// serveFeed streams the events of $all, of a stream or of a type as
+// server-sent events, from the from parameter or from the position following
+// the Last-Event-ID header on, then live as they are appended. Each message's
+// id is the global position of its event, so a reconnecting client resumes
+// where it left off.
+func (me *httpHandler) serveFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed: "+r.Method))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("Streaming isn't supported by the connection."))
+		return
+	}
+
+	var filter actions.SubscriptionFilter
+	target := strings.TrimPrefix(r.URL.Path, "/feed/")
+	switch {
+	case target == "all":
+	case strings.HasPrefix(target, "streams/"):
+		streamId, err := uuid.FromString(strings.TrimPrefix(target, "streams/"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, errors.New("Wrong format for stream id: "+err.Error()))
+			return
+		}
+		filter.StreamId = streamId
+	case strings.HasPrefix(target, "types/") && len(target) > len("types/"):
+		filter.TypeId = strings.TrimPrefix(target, "types/")
+	default:
+		writeError(w, http.StatusNotFound, errors.New("Unknown feed: "+target))
+		return
+	}
+
+	from, err := feedStart(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = me.handler.Authorize(filter.Operation(), filter.StreamId, filter.TypeId); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	fmt.Println("-> GET feed", target, "from", from)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	err = me.handler.Subscribe(from, filter, r.Context().Done(), func(position uint64, event *data.Event) error {
+		httpEvent, err := newHttpEvent(event)
+		if err != nil {
+			return err
+		}
+		httpEvent.Position = &position
+		content, err := json.Marshal(httpEvent)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(w, "id: %v\nevent: %s\ndata: %s\n\n", position, httpEvent.TypeId, content); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Feed", target, "ended:", err)
+	}
+}
+
+// feedStart returns the global position a feed starts at.
+func feedStart(r *http.Request) (uint64, error) {
+	if lastEventId := r.Header.Get(LAST_EVENT_ID_HEADER); lastEventId != "" {
+		position, err := strconv.ParseUint(lastEventId, 10, 64)
+		if err != nil {
+			return 0, errors.New("Wrong format for " + LAST_EVENT_ID_HEADER + ": " + err.Error())
+		}
+		return position + 1, nil
+	}
+	if from := r.URL.Query().Get("from"); from != "" {
+		position, err := strconv.ParseUint(from, 10, 64)
+		if err != nil {
+			return 0, errors.New("Wrong format for from: " + err.Error())
+		}
+		return position, nil
+	}
+	return 0, nil
+}
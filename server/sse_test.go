@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type sseMessage struct {
+	id    string
+	event string
+	data  *HttpEvent
+}
+
+func openFeed(t *testing.T, url string, lastEventId string) (*http.Response, *bufio.Reader) {
+	request, _ := http.NewRequest("GET", url, nil)
+	if lastEventId != "" {
+		request.Header.Set(LAST_EVENT_ID_HEADER, lastEventId)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		t.Fatalf("GET %s failed with status %v", url, response.StatusCode)
+	}
+	return response, bufio.NewReader(response.Body)
+}
+
+func readMessage(t *testing.T, reader *bufio.Reader) *sseMessage {
+	message := &sseMessage{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return message
+		}
+		field := strings.SplitN(line, ": ", 2)
+		switch field[0] {
+		case "id":
+			message.id = field[1]
+		case "event":
+			message.event = field[1]
+		case "data":
+			if err = json.Unmarshal([]byte(field[1]), &message.data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func assertMessage(t *testing.T, message *sseMessage, id string, typeId string, payload string) {
+	if message.id != id || message.event != typeId || message.data == nil || string(message.data.Payload) != payload {
+		t.Errorf("Got message %+v with data %+v, expected id %s, event %s and payload %s", message, message.data, id, typeId, payload)
+	}
+}
+
+func TestFeedResumesAfterLastEventIdThenGoesLive(t *testing.T) {
+	//Arrange
+	server := newHttpTestServer()
+	defer server.Close()
+	streamUrl := server.URL + "/streams/" + uuid.NewV4().String()
+	postEvent(t, streamUrl, "", `{"typeId":"AnEvent","payload":{"A":1}}`)
+	postEvent(t, streamUrl, "", `{"typeId":"AnEvent","payload":{"A":2}}`)
+
+	//Act
+	response, reader := openFeed(t, server.URL+"/feed/all", "0")
+	defer response.Body.Close()
+	caughtUp := readMessage(t, reader)
+	postEvent(t, streamUrl, "", `{"typeId":"AnEvent","payload":{"A":3}}`)
+	live := readMessage(t, reader)
+
+	//Assert
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Got content type %s", contentType)
+	}
+	assertMessage(t, caughtUp, "1", "AnEvent", `{"A":2}`)
+	assertMessage(t, live, "2", "AnEvent", `{"A":3}`)
+	if live.data.Position == nil || *live.data.Position != 2 {
+		t.Errorf("Live event has position %v, expected 2", live.data.Position)
+	}
+}
+
+func TestFeedFiltersByStreamAndType(t *testing.T) {
+	//Arrange
+	server := newHttpTestServer()
+	defer server.Close()
+	streamId := uuid.NewV4().String()
+	otherStreamUrl := server.URL + "/streams/" + uuid.NewV4().String()
+	postEvent(t, server.URL+"/streams/"+streamId, "", `{"typeId":"AnEvent","payload":{"A":1}}`)
+	postEvent(t, otherStreamUrl, "", `{"typeId":"OtherEvent","payload":{"B":1}}`)
+	postEvent(t, otherStreamUrl, "", `{"typeId":"AnEvent","payload":{"A":2}}`)
+
+	//Act
+	streamResponse, streamReader := openFeed(t, server.URL+"/feed/streams/"+streamId, "")
+	defer streamResponse.Body.Close()
+	typeResponse, typeReader := openFeed(t, server.URL+"/feed/types/OtherEvent?from=1", "")
+	defer typeResponse.Body.Close()
+
+	//Assert
+	assertMessage(t, readMessage(t, streamReader), "0", "AnEvent", `{"A":1}`)
+	assertMessage(t, readMessage(t, typeReader), "1", "OtherEvent", `{"B":1}`)
+}
+
+func TestFeedBadRequests(t *testing.T) {
+	server := newHttpTestServer()
+	defer server.Close()
+
+	for url, status := range map[string]int{
+		"/feed/streams/abc": http.StatusNotFound,
+		"/feed/types/":      http.StatusNotFound,
+		"/feed/other":       http.StatusNotFound,
+		"/feed/all?from=-1": http.StatusBadRequest,
+	} {
+		response, err := http.Get(server.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != status {
+			t.Errorf("GET %s got status %v, expected %v", url, response.StatusCode, status)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package zmqtransport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/pebbe/zmq4"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CurveConfig secures a ZeroMQ transport with CURVE: requests are encrypted,
+// clients must know the public key of the server and the server only accepts
+// clients whose public key is in AllowedClients, any client if it is empty.
+// Keys are Z85 encoded, as written by `goes keygen`.
+type CurveConfig struct {
+	SecretKey      string
+	AllowedClients []string
+}
+
+// The ZAP handler checking client keys is global to the process and sees only
+// the sockets of the default ZeroMQ context.
+var startAuth sync.Once
+var startAuthErr error
+
+// USER_ID_PROPERTY is the message property holding the public key the ZAP
+// handler authenticated the client with.
+const USER_ID_PROPERTY = "User-Id"
+
+func startZapHandler() error {
+	startAuth.Do(func() {
+		zmq4.AuthSetMetadataHandler(func(version, requestId, domain, address, identity, mechanism string, credentials ...string) map[string]string {
+			if mechanism != "CURVE" || len(credentials) == 0 {
+				return map[string]string{}
+			}
+			return map[string]string{USER_ID_PROPERTY: zmq4.Z85encode(credentials[0])}
+		})
+		startAuthErr = zmq4.AuthStart()
+	})
+	return startAuthErr
+}
+
+// secure makes socket a CURVE server allowing the clients of config. The ZAP
+// domain is the address, so transports can allow different clients.
+func (me *CurveConfig) secure(socket *zmq4.Socket, addr string) error {
+	if err := startZapHandler(); err != nil {
+		return err
+	}
+	if len(me.AllowedClients) == 0 {
+		zmq4.AuthCurveAdd(addr, zmq4.CURVE_ALLOW_ANY)
+	} else {
+		zmq4.AuthCurveAdd(addr, me.AllowedClients...)
+	}
+	return socket.ServerAuthCurve(addr, me.SecretKey)
+}
+
+func checkKey(key string) error {
+	if len(key) != 40 || len(zmq4.Z85decode(key)) != 32 {
+		return errors.New(fmt.Sprintf("Not a Z85 encoded CURVE key: %q", key))
+	}
+	return nil
+}
+
+// ReadKeyFile reads a key file written by `goes keygen`.
+func ReadKeyFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSpace(string(content))
+	if err = checkKey(key); err != nil {
+		return "", errors.New(path + ": " + err.Error())
+	}
+	return key, nil
+}
+
+// ReadKeysFile reads one public key per line, skipping blank lines and lines
+// starting with #.
+func ReadKeysFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		key := strings.TrimSpace(scanner.Text())
+		if key == "" || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if err = checkKey(key); err != nil {
+			return nil, errors.New(fmt.Sprintf("%s:%v: %v", path, line, err))
+		}
+		keys = append(keys, key)
+	}
+	return keys, scanner.Err()
+}
@@ -0,0 +1,143 @@
+// Package zmqtransport serves the frame-based protocol of a server.Server on
+// ZeroMQ sockets, optionally secured with CURVE.
+package zmqtransport
+
+import (
+	actions "../../actions"
+	server "../../server"
+	"fmt"
+	"github.com/pebbe/zmq4"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const NO_FLAGS = zmq4.Flag(0)
+
+// POLL_INTERVAL is how often a ZeroMQ transport waiting for requests checks
+// whether it was closed: sockets can't be closed from another goroutine.
+const POLL_INTERVAL = 100 * time.Millisecond
+
+// ZeroMQTransport serves the frame-based protocol on a REP socket. Its context
+// is nil when the socket belongs to the default context, as CURVE sockets do.
+type ZeroMQTransport struct {
+	addr        string
+	curve       bool
+	context     *zmq4.Context
+	replySocket *zmq4.Socket
+	lock        sync.Mutex
+	serving     bool
+	closing     chan struct{}
+	closed      chan struct{}
+}
+
+// NewZeroMQTransport binds a REP socket to addr, e.g. "tcp://127.0.0.1:12345".
+func NewZeroMQTransport(addr string) (*ZeroMQTransport, error) {
+	return NewCurveZeroMQTransport(addr, nil)
+}
+
+// NewCurveZeroMQTransport binds a REP socket to addr, secured with CURVE
+// unless curve is nil.
+func NewCurveZeroMQTransport(addr string, curve *CurveConfig) (*ZeroMQTransport, error) {
+	var context *zmq4.Context
+	var replySocket *zmq4.Socket
+	var err error
+	if curve == nil {
+		if context, err = zmq4.NewContext(); err != nil {
+			return nil, err
+		}
+		replySocket, err = context.NewSocket(zmq4.REP)
+	} else {
+		// The ZAP handler only authenticates sockets of the default context.
+		replySocket, err = zmq4.NewSocket(zmq4.REP)
+		if err == nil {
+			err = curve.secure(replySocket, addr)
+		}
+	}
+	if err == nil {
+		err = replySocket.SetRcvtimeo(POLL_INTERVAL)
+	}
+	if err == nil {
+		err = replySocket.Bind(addr)
+	}
+	if err != nil {
+		if replySocket != nil {
+			replySocket.Close()
+		}
+		if context != nil {
+			context.Term()
+		}
+		return nil, err
+	}
+	return &ZeroMQTransport{addr: addr, curve: curve != nil, context: context, replySocket: replySocket, closing: make(chan struct{}), closed: make(chan struct{})}, nil
+}
+
+func (me *ZeroMQTransport) Serve(server *server.Server) error {
+	me.lock.Lock()
+	select {
+	case <-me.closing:
+		me.lock.Unlock()
+		return nil
+	default:
+	}
+	me.serving = true
+	me.lock.Unlock()
+
+	defer close(me.closed)
+	defer me.terminate()
+
+	fmt.Println("Listening for incoming commands on:", me.addr)
+	for {
+		select {
+		case <-me.closing:
+			return nil
+		default:
+		}
+
+		principal, message, err := me.receive()
+		if err == zmq4.Errno(syscall.EAGAIN) {
+			continue
+		}
+		if err != nil {
+			fmt.Println("Error receiving command from client", err)
+			continue
+		}
+
+		if _, err = me.replySocket.SendMessage(server.DispatchAs(principal, message)); err != nil {
+			fmt.Println("Error sending reply to client", err)
+		}
+	}
+}
+
+// receive returns the next request and its principal: the public key of the
+// client with CURVE, ANONYMOUS otherwise.
+func (me *ZeroMQTransport) receive() (string, [][]byte, error) {
+	if !me.curve {
+		message, err := me.replySocket.RecvMessageBytes(NO_FLAGS)
+		return actions.ANONYMOUS, message, err
+	}
+	message, metadata, err := me.replySocket.RecvMessageBytesWithMetadata(NO_FLAGS, USER_ID_PROPERTY)
+	return metadata[USER_ID_PROPERTY], message, err
+}
+
+// Close stops serving once the request in progress, if any, is answered.
+func (me *ZeroMQTransport) Close() error {
+	me.lock.Lock()
+	close(me.closing)
+	serving := me.serving
+	me.lock.Unlock()
+
+	if !serving {
+		return me.terminate()
+	}
+	<-me.closed
+	return nil
+}
+
+func (me *ZeroMQTransport) terminate() error {
+	me.replySocket.Close()
+	if me.context == nil {
+		return nil
+	}
+	return me.context.Term()
+}
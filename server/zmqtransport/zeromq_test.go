@@ -0,0 +1,41 @@
+package zmqtransport
+
+import (
+	actions "../../actions"
+	serializer "../../serializer"
+	server "../../server"
+	storage "../../storage"
+	"testing"
+	"time"
+)
+
+func TestZeroMQTransportsListenOnSeveralAddresses(t *testing.T) {
+	//Arrange
+	first, err := NewZeroMQTransport("tcp://127.0.0.1:23457")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewZeroMQTransport("tcp://127.0.0.1:23458")
+	if err != nil {
+		first.Close()
+		t.Fatal(err)
+	}
+	srv := server.NewServer(actions.NewActionsHandler(storage.NewInMemoryStorage(), serializer.NewPassthruSerializer()))
+	result := make(chan error, 1)
+	go func() {
+		result <- srv.Run(first, second)
+	}()
+
+	//Act
+	srv.Shutdown()
+
+	//Assert
+	select {
+	case err = <-result:
+		if err != nil {
+			t.Errorf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after Shutdown")
+	}
+}
@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BackupStorage is implemented by storages that can copy a consistent
+// snapshot of themselves while writes go on. Backup returns the global
+// position the snapshot was frozen at: the backup holds exactly the events
+// before it.
+type BackupStorage interface {
+	Backup(target BackupTarget) (uint64, error)
+}
+
+// BackupTarget receives the files of a backup, named relative to the root of
+// the backed up store.
+type BackupTarget interface {
+	WriteFile(name string, size int64, content io.Reader) error
+	Close() error
+}
+
+// OpenBackupTarget writes a tar file if target ends with .tar, a directory
+// otherwise. Neither may exist already.
+func OpenBackupTarget(target string) (BackupTarget, error) {
+	if strings.HasSuffix(target, ".tar") {
+		file, err := os.OpenFile(target, os.O_EXCL|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &tarBackupTarget{tar.NewWriter(file), file}, nil
+	}
+	return NewDirBackupTarget(target)
+}
+
+// BackupTo backs storage up to target, a directory or a .tar file, and returns
+// the global position the backup was frozen at.
+func BackupTo(storage Storage, target string) (uint64, error) {
+	if _, ok := storage.(BackupStorage); !ok {
+		return 0, errors.New("Backup isn't supported by this storage.")
+	}
+	backupTarget, err := OpenBackupTarget(target)
+	if err != nil {
+		return 0, err
+	}
+	return BackupToTarget(storage, backupTarget)
+}
+
+// BackupToTarget backs storage up to target, e.g. a tar stream, then closes
+// target, and returns the global position the backup was frozen at.
+func BackupToTarget(storage Storage, target BackupTarget) (uint64, error) {
+	backupStorage, ok := storage.(BackupStorage)
+	if !ok {
+		target.Close()
+		return 0, errors.New("Backup isn't supported by this storage.")
+	}
+	position, err := backupStorage.Backup(target)
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	return position, err
+}
+
+type dirBackupTarget struct {
+	backupPath string
+	dirs       map[string]bool
+}
+
+func NewDirBackupTarget(backupPath string) (BackupTarget, error) {
+	if _, err := os.Stat(backupPath); err == nil {
+		return nil, errors.New(fmt.Sprintf("Backup path %s already exists.", backupPath))
+	}
+	if err := os.MkdirAll(backupPath, 0777); err != nil {
+		return nil, err
+	}
+	return &dirBackupTarget{backupPath, map[string]bool{backupPath: true}}, nil
+}
+
+func (me *dirBackupTarget) WriteFile(name string, size int64, content io.Reader) error {
+	filename := path.Join(me.backupPath, name)
+	if err := os.MkdirAll(path.Dir(filename), 0777); err != nil {
+		return err
+	}
+	me.dirs[path.Dir(filename)] = true
+
+	file, err := os.OpenFile(filename, os.O_EXCL|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = io.CopyN(file, content, size); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func (me *dirBackupTarget) Close() error {
+	return syncDirs(me.dirs)
+}
+
+type tarBackupTarget struct {
+	writer *tar.Writer
+	file   *os.File
+}
+
+// NewTarBackupTarget writes the backup as a tar stream.
+func NewTarBackupTarget(w io.Writer) BackupTarget {
+	return &tarBackupTarget{tar.NewWriter(w), nil}
+}
+
+func (me *tarBackupTarget) WriteFile(name string, size int64, content io.Reader) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := me.writer.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(me.writer, content, size)
+	return err
+}
+
+func (me *tarBackupTarget) Close() error {
+	if err := me.writer.Close(); err != nil {
+		return err
+	}
+	if me.file == nil {
+		return nil
+	}
+	if err := me.file.Sync(); err != nil {
+		me.file.Close()
+		return err
+	}
+	return me.file.Close()
+}
+
+func backupFile(target BackupTarget, name string, filename string, size int64) error {
+	file, err := os.OpenFile(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return target.WriteFile(name, size, file)
+}
+
+func backupBytes(target BackupTarget, name string, content []byte) error {
+	return target.WriteFile(name, int64(len(content)), bytes.NewReader(content))
+}
+
+// Backup freezes the global position under the write lock, then copies the
+// format file, the global index up to that position, the entries of stream
+// and type indexes before it and the event files they reference. Event files
+// are never modified and indexes are only appended to, so writes go on during
+// the copy. Rebuilding type indexes waits for the backup to end.
+func (me *DailyDiskStorage) Backup(target BackupTarget) (uint64, error) {
+	me.rebuildLock.Lock()
+	defer me.rebuildLock.Unlock()
+
+	me.writeLock.Lock()
+	position := me.nextPosition
+	globalIndexSize := int64(0)
+	stat, err := os.Stat(me.globalIndexFilename)
+	if err == nil {
+		globalIndexSize = stat.Size()
+	}
+	me.writeLock.Unlock()
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	relative := func(filename string) string {
+		return filename[len(me.storagePath)+1:]
+	}
+	if err = backupBytes(target, formatFilename, []byte(strconv.Itoa(me.format))); err != nil {
+		return 0, err
+	}
+	if err = backupFile(target, relative(me.globalIndexFilename), me.globalIndexFilename, globalIndexSize); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	copied := make(map[string]bool)
+	count := uint64(0)
+	err = me.forEachGlobalEntry(func(entry *IndexEntry) error {
+		if count == position {
+			return errBackupComplete
+		}
+		count++
+		filename := me.getEventFilename(entry)
+		if copied[filename] {
+			return nil
+		}
+		copied[filename] = true
+		stat, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		return backupFile(target, relative(filename), filename, stat.Size())
+	})
+	if err != nil && err != errBackupComplete {
+		return 0, err
+	}
+
+	files, err := ioutil.ReadDir(me.indexesPath)
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		streamId, err := uuid.FromString(file.Name())
+		if err != nil || file.IsDir() {
+			continue
+		}
+		if err = me.backupStreamIndex(target, me.getStreamIndexFilename(streamId), position); err != nil {
+			return 0, err
+		}
+	}
+
+	files, err = ioutil.ReadDir(me.typesIndexesPath)
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		if err = me.backupTypeIndex(target, me.getTypeIndexFilename(file.Name()), position); err != nil {
+			return 0, err
+		}
+	}
+
+	return position, nil
+}
+
+var errBackupComplete = errors.New("Backup complete")
+
+// backupStreamIndex copies the entries of a stream index before position.
+func (me *DailyDiskStorage) backupStreamIndex(target BackupTarget, filename string, position uint64) error {
+	indexFile, err := os.OpenFile(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer indexFile.Close()
+
+	size := int64(0)
+	for {
+		entry, err := readIndexNextEntry(indexFile, me.format)
+		if err != nil && err.Error() == "EOF" {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if me.format > 1 && entry.position >= position {
+			break
+		}
+		if size, err = indexFile.Seek(0, os.SEEK_CUR); err != nil {
+			return err
+		}
+	}
+	if size == 0 {
+		return nil
+	}
+	if _, err = indexFile.Seek(0, os.SEEK_SET); err != nil {
+		return err
+	}
+	return target.WriteFile(filename[len(me.storagePath)+1:], size, indexFile)
+}
+
+// backupTypeIndex copies the lines of a type index before position, which
+// event filenames hold from format 2 on.
+func (me *DailyDiskStorage) backupTypeIndex(target BackupTarget, filename string, position uint64) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	size := 0
+	for size < len(content) {
+		end := bytes.Index(content[size:], CRLF)
+		if end == -1 {
+			break
+		}
+		if me.format > 1 {
+			fields := strings.SplitN(path.Base(string(content[size:size+end])), "_", 3)
+			if len(fields) < 3 {
+				return errors.New(fmt.Sprintf("Integrity error. Unexpected line in %s at offset %v.", filename, size))
+			}
+			linePosition, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return errors.New(fmt.Sprintf("Integrity error. Unexpected line in %s at offset %v.", filename, size))
+			}
+			if linePosition >= position {
+				break
+			}
+		}
+		size += end + len(CRLF)
+	}
+	if size == 0 {
+		return nil
+	}
+	return backupBytes(target, filename[len(me.storagePath)+1:], content[:size])
+}
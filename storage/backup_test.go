@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/satori/go.uuid"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func extractTar(t *testing.T, tarFilename string, targetPath string) {
+	file, err := os.Open(tarFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		filename := path.Join(targetPath, header.Name)
+		os.MkdirAll(path.Dir(filename), 0777)
+		extracted, err := os.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(extracted, reader)
+		extracted.Close()
+	}
+}
+
+func assertBackupHolds(t *testing.T, backupPath string, expected []*StoredEvent) {
+	out := new(bytes.Buffer)
+	if problems, err := VerifyDailyDiskStorage(backupPath, out); err != nil || problems != 0 {
+		t.Errorf("Backup failed. Got %v problems and error %v. Report:\n%s", problems, err, out)
+	}
+	events, err := NewDailyDiskStorage(backupPath).ReadAll()
+	if err != nil || !reflect.DeepEqual(events, expected) {
+		t.Errorf("Backup failed. Got %v events and error %v, expected %v events", len(events), err, len(expected))
+	}
+}
+
+func TestBackupToDirectoryAndTar(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewDailyDiskStorage(storagePath).(*DailyDiskStorage)
+	for i := 0; i < 5; i++ {
+		storage.Write(&StoredEvent{uuid.NewV4(), time.Now().Round(0), "aType", []byte("{}"), "Metadata", []byte("{}")})
+	}
+	written, _ := storage.ReadAll()
+	backupPath := storagePath + ".backup"
+	defer os.RemoveAll(backupPath)
+	tarFilename := storagePath + ".tar"
+	defer os.Remove(tarFilename)
+
+	//Act
+	dirTarget, err := OpenBackupTarget(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirPosition, dirErr := storage.Backup(dirTarget)
+	dirTarget.Close()
+	tarTarget, err := OpenBackupTarget(tarFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarPosition, tarErr := storage.Backup(tarTarget)
+	tarTarget.Close()
+
+	//Assert
+	if dirErr != nil || tarErr != nil || dirPosition != 5 || tarPosition != 5 {
+		t.Fatalf("Backup failed. Got positions %v and %v, errors %v and %v", dirPosition, tarPosition, dirErr, tarErr)
+	}
+	assertBackupHolds(t, backupPath, written)
+	extractedPath := storagePath + ".extracted"
+	defer os.RemoveAll(extractedPath)
+	extractTar(t, tarFilename, extractedPath)
+	assertBackupHolds(t, extractedPath, written)
+}
+
+func TestBackupWithConcurrentWrites(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewDailyDiskStorage(storagePath).(*DailyDiskStorage)
+	writeTypedEvents(t, storage, 50)
+	backupPath := storagePath + ".backup"
+	defer os.RemoveAll(backupPath)
+
+	//Act
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		writeTypedEvents(t, storage, 50)
+	}()
+	target, err := OpenBackupTarget(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	position, err := storage.Backup(target)
+	target.Close()
+	wg.Wait()
+
+	//Assert
+	if err != nil {
+		t.Fatalf("Backup failed. Error: %v", err)
+	}
+	written, _ := storage.ReadAll()
+	assertBackupHolds(t, backupPath, written[:position])
+}
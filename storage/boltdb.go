@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path"
+	"time"
+)
+
+const BOLT_FILENAME = "events.db"
+
+// The events bucket is keyed by global position and doubles as the global
+// index. Streams and types hold one nested bucket per stream id or type id,
+// mapping a sequence number to the global position of the event.
+var eventsBucket = []byte("events")
+var streamsBucket = []byte("streams")
+var typesBucket = []byte("types")
+
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+func NewBoltStorage(storagePath string) Storage {
+	fmt.Println("Using BoltStorage path:", storagePath)
+	if err := os.MkdirAll(storagePath, 0777); err != nil {
+		panic(err)
+	}
+	db, err := bolt.Open(path.Join(storagePath, BOLT_FILENAME), 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		panic(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{eventsBucket, streamsBucket, typesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return &BoltStorage{db}
+}
+
+func (me *BoltStorage) Close() error {
+	return me.db.Close()
+}
+
+func sequenceKey(sequence uint64) []byte {
+	key := make([]byte, IntegerSizeInBytes)
+	binary.BigEndian.PutUint64(key, sequence)
+	return key
+}
+
+func encodeBoltEvent(event *StoredEvent) ([]byte, error) {
+	creationTimeBytes, err := event.CreationTime.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	value := append([]byte{}, event.StreamId.Bytes()...)
+	value = appendSizedBytes(value, creationTimeBytes)
+	value = appendSizedBytes(value, []byte(event.TypeId))
+	value = appendSizedBytes(value, event.Data)
+	value = appendSizedBytes(value, []byte(event.MetadataTypeId))
+	value = appendSizedBytes(value, event.Metadata)
+	return value, nil
+}
+
+func decodeBoltEvent(value []byte) (*StoredEvent, error) {
+	if len(value) < 16 {
+		return nil, errors.New("Integrity error. Event is too short.")
+	}
+	event := &StoredEvent{StreamId: uuid.FromBytesOrNil(value[0:16])}
+	rest := value[16:]
+
+	fields := make([][]byte, 5)
+	for i := range fields {
+		var err error
+		if fields[i], rest, err = takeSizedBytes(rest); err != nil {
+			return nil, err
+		}
+	}
+	if err := event.CreationTime.UnmarshalBinary(fields[0]); err != nil {
+		return nil, err
+	}
+	event.TypeId = string(fields[1])
+	event.Data = append([]byte{}, fields[2]...)
+	event.MetadataTypeId = string(fields[3])
+	event.Metadata = append([]byte{}, fields[4]...)
+	return event, nil
+}
+
+func appendSequence(parent *bolt.Bucket, name []byte, value []byte) error {
+	bucket, err := parent.CreateBucketIfNotExists(name)
+	if err != nil {
+		return err
+	}
+	sequence, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	return bucket.Put(sequenceKey(sequence-1), value)
+}
+
+// SetDurability turns off the flush bolt does on every commit when durability
+// is none. Otherwise each Write or WriteBatch is a single flushed transaction.
+func (me *BoltStorage) SetDurability(durability Durability) {
+	me.db.NoSync = durability == DURABILITY_NONE
+}
+
+func (me *BoltStorage) Write(event *StoredEvent) error {
+	return me.WriteBatch([]*StoredEvent{event})
+}
+
+func (me *BoltStorage) WriteBatch(events []*StoredEvent) error {
+	values := make([][]byte, len(events))
+	for i, event := range events {
+		value, err := encodeBoltEvent(event)
+		if err != nil {
+			return err
+		}
+		values[i] = value
+	}
+
+	err := me.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		for i, event := range events {
+			sequence, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			position := sequenceKey(sequence - 1)
+			if err = bucket.Put(position, values[i]); err != nil {
+				return err
+			}
+			if err = appendSequence(tx.Bucket(streamsBucket), event.StreamId.Bytes(), position); err != nil {
+				return err
+			}
+			if err = appendSequence(tx.Bucket(typesBucket), []byte(event.TypeId), position); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == bolt.ErrDatabaseNotOpen {
+		return ErrClosed
+	}
+	return err
+}
+
+func (me *BoltStorage) StreamVersion(streamId uuid.UUID) (uint32, error) {
+	ver := EMPTY_STREAM
+	err := me.db.View(func(tx *bolt.Tx) error {
+		stream := tx.Bucket(streamsBucket).Bucket(streamId.Bytes())
+		if stream == nil {
+			return errors.New("NOT_FOUND: stream " + streamId.String())
+		}
+		ver = uint32(stream.Sequence())
+		return nil
+	})
+	return ver, err
+}
+
+func (me *BoltStorage) ReadStream(streamId uuid.UUID) ([]*StoredEvent, error) {
+	results := make([]*StoredEvent, 0)
+	err := me.db.View(func(tx *bolt.Tx) error {
+		stream := tx.Bucket(streamsBucket).Bucket(streamId.Bytes())
+		if stream == nil {
+			return errors.New("NOT_FOUND: stream " + streamId.String())
+		}
+		events := tx.Bucket(eventsBucket)
+		cursor := stream.Cursor()
+		for _, position := cursor.First(); position != nil; _, position = cursor.Next() {
+			event, err := decodeBoltEvent(events.Get(position))
+			if err != nil {
+				return err
+			}
+			results = append(results, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (me *BoltStorage) ReadAll() ([]*StoredEvent, error) {
+	results := make([]*StoredEvent, 0)
+	err := me.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(eventsBucket).ForEach(func(position, value []byte) error {
+			event, err := decodeBoltEvent(value)
+			if err != nil {
+				return err
+			}
+			results = append(results, event)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// RebuildTypeIndexes regenerates the types bucket in a single transaction, so
+// writes simply wait for it.
+func (me *BoltStorage) RebuildTypeIndexes() error {
+	fmt.Print("Rebuilding type indexes... ")
+
+	err := me.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(typesBucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		types, err := tx.CreateBucket(typesBucket)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(eventsBucket).ForEach(func(position, value []byte) error {
+			event, err := decodeBoltEvent(value)
+			if err != nil {
+				return err
+			}
+			return appendSequence(types, []byte(event.TypeId), position)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Done.")
+	return nil
+}
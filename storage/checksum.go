@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+const checksumSize = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorruption is what a CorruptionError unwraps to, for callers that only
+// need to know a record failed its checksum.
+var ErrCorruption = errors.New("Data corruption")
+
+// CorruptionError reports a record that doesn't match its checksum or can't
+// be decoded, with the file and offset it was read from.
+type CorruptionError struct {
+	Filename string
+	Offset   int64
+	Reason   string
+}
+
+func (me *CorruptionError) Error() string {
+	return fmt.Sprintf("Integrity error. %s in %s at offset %v.", me.Reason, me.Filename, me.Offset)
+}
+
+func (me *CorruptionError) Unwrap() error {
+	return ErrCorruption
+}
+
+func IsCorruption(err error) bool {
+	_, ok := err.(*CorruptionError)
+	return ok
+}
+
+// appendChecksum appends the CRC32C of record to it.
+func appendChecksum(record []byte) []byte {
+	checksum := make([]byte, checksumSize)
+	binary.BigEndian.PutUint32(checksum, crc32.Checksum(record, castagnoli))
+	return append(record, checksum...)
+}
+
+func validChecksum(record []byte, checksum []byte) bool {
+	return len(checksum) == checksumSize && crc32.Checksum(record, castagnoli) == binary.BigEndian.Uint32(checksum)
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"github.com/satori/go.uuid"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func flipByte(t *testing.T, filename string, offset int64) {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	b := make([]byte, 1)
+	if _, err = file.ReadAt(b, offset); err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 0xFF
+	if _, err = file.WriteAt(b, offset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertCorruption(t *testing.T, err error, filename string, offset int64) {
+	corruption, ok := err.(*CorruptionError)
+	if !ok {
+		t.Errorf("Expected a CorruptionError, got %v", err)
+		return
+	}
+	if corruption.Filename != filename || corruption.Offset != offset {
+		t.Errorf("Got corruption in %s at offset %v, expected %s at offset %v", corruption.Filename, corruption.Offset, filename, offset)
+	}
+	if corruption.Unwrap() != ErrCorruption {
+		t.Errorf("Expected CorruptionError to unwrap to ErrCorruption, got %v", corruption.Unwrap())
+	}
+}
+
+func TestDailyDiskEventFileChecksumMismatch(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewDailyDiskStorage(storagePath).(*DailyDiskStorage)
+	streamId := uuid.NewV4()
+	event := &StoredEvent{streamId, time.Now(), "aType", []byte("1stEvent"), "Metadata", []byte("{}")}
+	storage.Write(event)
+	eventFilename := storage.getEventFilename(&IndexEntry{streamId, 0, event.CreationTime, event.TypeId})
+	flipByte(t, eventFilename, IntegerSizeInBytes)
+
+	//Act
+	_, err := storage.ReadStream(streamId)
+
+	//Assert
+	assertCorruption(t, err, eventFilename, 0)
+}
+
+func TestDailyDiskIndexEntryChecksumMismatch(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewDailyDiskStorage(storagePath).(*DailyDiskStorage)
+	streamId := uuid.NewV4()
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("1stEvent"), "Metadata", []byte("{}")})
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("2ndEvent"), "Metadata", []byte("{}")})
+	stat, _ := os.Stat(storage.globalIndexFilename)
+	entrySize := stat.Size() / 2
+	flipByte(t, storage.globalIndexFilename, entrySize+20)
+
+	//Act
+	_, err := storage.ReadAll()
+
+	//Assert
+	assertCorruption(t, err, storage.globalIndexFilename, entrySize)
+}
+
+func TestSimpleDiskRecordChecksumMismatch(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewSimpleDiskStorage(storagePath).(*SimpleDiskStorage)
+	streamId := uuid.NewV4()
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("1stEvent"), "Metadata", []byte("{}")})
+	stat, _ := os.Stat(storage.GetFilenameForEvents(streamId.String()))
+	recordSize := stat.Size()
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("2ndEvent"), "Metadata", []byte("{}")})
+	flipByte(t, storage.GetFilenameForEvents(streamId.String()), recordSize+recordSize-1)
+
+	//Act
+	_, streamErr := storage.ReadStream(streamId)
+	_, allErr := storage.ReadAll()
+
+	//Assert
+	assertCorruption(t, streamErr, storage.GetFilenameForEvents(streamId.String()), recordSize)
+	assertCorruption(t, allErr, storage.GetFilenameForEvents(streamId.String()), recordSize)
+}
+
+func TestSimpleDiskIndexEntryChecksumMismatch(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewSimpleDiskStorage(storagePath).(*SimpleDiskStorage)
+	storage.Write(&StoredEvent{uuid.NewV4(), time.Now(), "aType", []byte("1stEvent"), "Metadata", []byte("{}")})
+	flipByte(t, storage.indexPath, 3)
+
+	//Act
+	_, err := storage.ReadAll()
+
+	//Assert
+	assertCorruption(t, err, storage.indexPath, 0)
+}
@@ -0,0 +1,686 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// Chunk files are allocated at CHUNK_SIZE when created, sparse where the file
+// system allows it, and records fill them up: a record that would take a chunk
+// past its size starts a new chunk instead. The end of the records is known
+// from the global index, not from the size of the file.
+const CHUNK_SIZE = int64(256 * 1024 * 1024)
+const chunkRecordHeaderSize = 8
+const chunkLocationSize = 16
+
+// ChunkDiskStorage appends every event as a checksummed record to the current
+// chunk file. Global, stream and type indexes hold fixed-size (chunk, offset)
+// locations, so the position of an event in an index is its offset / 16.
+type ChunkDiskStorage struct {
+	storagePath         string
+	chunksPath          string
+	indexesPath         string
+	typesIndexesPath    string
+	globalIndexFilename string
+	chunkSize           int64
+	durability          Durability
+	writeLock           sync.Mutex
+	rebuildLock         sync.Mutex
+	chunk               *os.File
+	chunkNumber         uint64
+	chunkOffset         int64
+	nextPosition        uint64
+	closed              bool
+}
+
+type chunkLocation struct {
+	chunk  uint64
+	offset int64
+}
+
+func NewChunkDiskStorage(storagePath string) Storage {
+	return newChunkDiskStorage(storagePath, CHUNK_SIZE)
+}
+
+func newChunkDiskStorage(storagePath string, chunkSize int64) *ChunkDiskStorage {
+	fmt.Println("Using ChunkDiskStorage path:", storagePath)
+	chunksPath := path.Join(storagePath, "chunks")
+	indexesPath := path.Join(storagePath, "indexes")
+	typesIndexesPath := path.Join(indexesPath, "types")
+	if err := recoverReplacedDir(typesIndexesPath); err != nil {
+		panic(err)
+	}
+	for _, dir := range []string{chunksPath, typesIndexesPath} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			panic(err)
+		}
+	}
+	storage := &ChunkDiskStorage{
+		storagePath:         storagePath,
+		chunksPath:          chunksPath,
+		indexesPath:         indexesPath,
+		typesIndexesPath:    typesIndexesPath,
+		globalIndexFilename: path.Join(indexesPath, "global"),
+		chunkSize:           chunkSize,
+	}
+	if err := storage.openLastChunk(); err != nil {
+		panic(err)
+	}
+	if err := storage.repairIndexes(); err != nil {
+		panic(err)
+	}
+	return storage
+}
+
+// openLastChunk positions the writer right after the last record referenced by
+// the global index. Anything past it was never acknowledged and is truncated.
+func (me *ChunkDiskStorage) openLastChunk() error {
+	globalIndex, err := os.OpenFile(me.globalIndexFilename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer globalIndex.Close()
+
+	stat, err := globalIndex.Stat()
+	if err != nil {
+		return err
+	}
+	count := stat.Size() / chunkLocationSize
+	if err = globalIndex.Truncate(count * chunkLocationSize); err != nil {
+		return err
+	}
+	me.nextPosition = uint64(count)
+
+	end := chunkLocation{0, 0}
+	if count > 0 {
+		last, err := readLocationAt(globalIndex, count-1)
+		if err != nil {
+			return err
+		}
+		size, err := me.readRecordSize(last)
+		if err != nil {
+			return err
+		}
+		end = chunkLocation{last.chunk, last.offset + chunkRecordHeaderSize + int64(size)}
+	}
+
+	me.chunk, err = os.OpenFile(me.getChunkFilename(end.chunk), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	me.chunkNumber = end.chunk
+	me.chunkOffset = end.offset
+	// Truncating then extending the chunk zeroes what follows the records.
+	if err = me.chunk.Truncate(end.offset); err != nil {
+		return err
+	}
+	return me.chunk.Truncate(me.chunkSize)
+}
+
+// repairIndexes appends to the stream and type indexes the locations of the
+// last events of the global index that they miss: a write interrupted after
+// the global index entry of an event leaves its other entries unwritten.
+// Entries are written in global order, so the events to repair are those
+// after the last one both of its indexes end with, found reading the global
+// index back from its tail.
+func (me *ChunkDiskStorage) repairIndexes() error {
+	globalIndex, err := os.OpenFile(me.globalIndexFilename, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer globalIndex.Close()
+	reader := me.newChunkReader()
+	defer reader.Close()
+
+	indexFilenames := func(location chunkLocation) ([]string, error) {
+		event, err := reader.read(location)
+		if err != nil {
+			return nil, err
+		}
+		return []string{me.getStreamIndexFilename(event.StreamId), me.getTypeIndexFilename(event.TypeId)}, nil
+	}
+	start := int64(me.nextPosition)
+	for ; start > 0; start-- {
+		location, err := readLocationAt(globalIndex, start-1)
+		if err != nil {
+			return err
+		}
+		filenames, err := indexFilenames(location)
+		if err != nil {
+			return err
+		}
+		complete := true
+		for _, filename := range filenames {
+			covered, err := indexCovers(filename, location)
+			if err != nil {
+				return err
+			}
+			complete = complete && covered
+		}
+		if complete {
+			break
+		}
+	}
+
+	for ; start < int64(me.nextPosition); start++ {
+		location, err := readLocationAt(globalIndex, start)
+		if err != nil {
+			return err
+		}
+		filenames, err := indexFilenames(location)
+		if err != nil {
+			return err
+		}
+		for _, filename := range filenames {
+			covered, err := indexCovers(filename, location)
+			if err != nil {
+				return err
+			}
+			if covered {
+				continue
+			}
+			fmt.Println("Repairing index", filename, "with the event at chunk", location.chunk, "offset", location.offset)
+			if err = appendLocation(filename, location); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexCovers tells whether an index holds location or a later one, after
+// truncating a torn trailing entry.
+func indexCovers(filename string, location chunkLocation) (bool, error) {
+	indexFile, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer indexFile.Close()
+
+	stat, err := indexFile.Stat()
+	if err != nil {
+		return false, err
+	}
+	count := stat.Size() / chunkLocationSize
+	if stat.Size() != count*chunkLocationSize {
+		if err = indexFile.Truncate(count * chunkLocationSize); err != nil {
+			return false, err
+		}
+	}
+	if count == 0 {
+		return false, nil
+	}
+	last, err := readLocationAt(indexFile, count-1)
+	if err != nil {
+		return false, err
+	}
+	return last.chunk > location.chunk || (last.chunk == location.chunk && last.offset >= location.offset), nil
+}
+
+func (me *ChunkDiskStorage) getChunkFilename(chunk uint64) string {
+	return path.Join(me.chunksPath, fmt.Sprintf("chunk-%012d", chunk))
+}
+
+func (me *ChunkDiskStorage) getStreamIndexFilename(streamId uuid.UUID) string {
+	return path.Join(me.indexesPath, streamId.String())
+}
+
+func (me *ChunkDiskStorage) getTypeIndexFilename(typeId string) string {
+	return path.Join(me.typesIndexesPath, typeId)
+}
+
+func appendLocation(filename string, location chunkLocation) error {
+	indexFile, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer indexFile.Close()
+
+	return writeLocation(indexFile, location)
+}
+
+func writeLocation(indexFile *os.File, location chunkLocation) error {
+	entry := make([]byte, chunkLocationSize)
+	binary.BigEndian.PutUint64(entry[0:8], location.chunk)
+	binary.BigEndian.PutUint64(entry[8:16], uint64(location.offset))
+	written, err := indexFile.Write(entry)
+	if err != nil {
+		return err
+	}
+	if written != chunkLocationSize {
+		return errors.New(fmt.Sprintf("Write error. Expected to write %v bytes, wrote only %v.", chunkLocationSize, written))
+	}
+	return nil
+}
+
+func readLocationAt(indexFile *os.File, index int64) (chunkLocation, error) {
+	entry := make([]byte, chunkLocationSize)
+	if _, err := indexFile.ReadAt(entry, index*chunkLocationSize); err != nil {
+		return chunkLocation{}, err
+	}
+	return decodeLocation(entry), nil
+}
+
+func decodeLocation(entry []byte) chunkLocation {
+	return chunkLocation{binary.BigEndian.Uint64(entry[0:8]), int64(binary.BigEndian.Uint64(entry[8:16]))}
+}
+
+func readLocations(filename string) ([]chunkLocation, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	count := len(content) / chunkLocationSize
+	locations := make([]chunkLocation, count)
+	for i := 0; i < count; i++ {
+		locations[i] = decodeLocation(content[i*chunkLocationSize:])
+	}
+	return locations, nil
+}
+
+func appendSizedBytes(buffer []byte, data []byte) []byte {
+	sizeBytes := make([]byte, IntegerSizeInBytes)
+	binary.BigEndian.PutUint64(sizeBytes, uint64(len(data)))
+	return append(append(buffer, sizeBytes...), data...)
+}
+
+func takeSizedBytes(buffer []byte) ([]byte, []byte, error) {
+	if len(buffer) < IntegerSizeInBytes {
+		return nil, nil, errors.New("Integrity error. Record is too short.")
+	}
+	size := binary.BigEndian.Uint64(buffer)
+	buffer = buffer[IntegerSizeInBytes:]
+	if uint64(len(buffer)) < size {
+		return nil, nil, errors.New("Integrity error. Record is too short.")
+	}
+	return buffer[:size], buffer[size:], nil
+}
+
+// A record is a 4 bytes body size and 4 bytes CRC-32C of the body, followed by
+// the stream id, global position, creation time, type, data, metadata type and
+// metadata.
+func encodeChunkRecord(event *StoredEvent, position uint64) ([]byte, error) {
+	creationTimeBytes, err := event.CreationTime.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	record := make([]byte, chunkRecordHeaderSize, chunkRecordHeaderSize+64+len(event.Data)+len(event.Metadata))
+	record = append(record, event.StreamId.Bytes()...)
+	positionBytes := make([]byte, IntegerSizeInBytes)
+	binary.BigEndian.PutUint64(positionBytes, position)
+	record = append(record, positionBytes...)
+	record = appendSizedBytes(record, creationTimeBytes)
+	record = appendSizedBytes(record, []byte(event.TypeId))
+	record = appendSizedBytes(record, event.Data)
+	record = appendSizedBytes(record, []byte(event.MetadataTypeId))
+	record = appendSizedBytes(record, event.Metadata)
+
+	body := record[chunkRecordHeaderSize:]
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(body, castagnoli))
+	return record, nil
+}
+
+func decodeChunkRecord(body []byte) (*StoredEvent, error) {
+	if len(body) < 16+IntegerSizeInBytes {
+		return nil, errors.New("Integrity error. Record is too short.")
+	}
+	streamId := uuid.FromBytesOrNil(body[0:16])
+	rest := body[16+IntegerSizeInBytes:]
+
+	creationTimeBytes, rest, err := takeSizedBytes(rest)
+	if err != nil {
+		return nil, err
+	}
+	var creationTime time.Time
+	if err = creationTime.UnmarshalBinary(creationTimeBytes); err != nil {
+		return nil, err
+	}
+	typeId, rest, err := takeSizedBytes(rest)
+	if err != nil {
+		return nil, err
+	}
+	data, rest, err := takeSizedBytes(rest)
+	if err != nil {
+		return nil, err
+	}
+	metadataTypeId, rest, err := takeSizedBytes(rest)
+	if err != nil {
+		return nil, err
+	}
+	metadata, _, err := takeSizedBytes(rest)
+	if err != nil {
+		return nil, err
+	}
+	return &StoredEvent{streamId, creationTime, string(typeId), data, string(metadataTypeId), metadata}, nil
+}
+
+func (me *ChunkDiskStorage) readRecordSize(location chunkLocation) (uint32, error) {
+	chunk, err := os.OpenFile(me.getChunkFilename(location.chunk), os.O_RDONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer chunk.Close()
+
+	header := make([]byte, chunkRecordHeaderSize)
+	if _, err = chunk.ReadAt(header, location.offset); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(header[0:4]), nil
+}
+
+// chunkReader keeps chunk files open for the duration of a read.
+type chunkReader struct {
+	storage *ChunkDiskStorage
+	chunks  map[uint64]*os.File
+}
+
+func (me *ChunkDiskStorage) newChunkReader() *chunkReader {
+	return &chunkReader{me, make(map[uint64]*os.File)}
+}
+
+func (me *chunkReader) Close() {
+	for _, chunk := range me.chunks {
+		chunk.Close()
+	}
+}
+
+func (me *chunkReader) read(location chunkLocation) (*StoredEvent, error) {
+	chunk := me.chunks[location.chunk]
+	if chunk == nil {
+		var err error
+		chunk, err = os.OpenFile(me.storage.getChunkFilename(location.chunk), os.O_RDONLY, 0)
+		if err != nil {
+			return nil, err
+		}
+		me.chunks[location.chunk] = chunk
+	}
+
+	header := make([]byte, chunkRecordHeaderSize)
+	if _, err := chunk.ReadAt(header, location.offset); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := chunk.ReadAt(body, location.offset+chunkRecordHeaderSize); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, &CorruptionError{chunk.Name(), location.offset, "Checksum mismatch"}
+	}
+	return decodeChunkRecord(body)
+}
+
+func (me *chunkReader) readAll(locations []chunkLocation) ([]*StoredEvent, error) {
+	events := make([]*StoredEvent, 0, len(locations))
+	for _, location := range locations {
+		event, err := me.read(location)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (me *ChunkDiskStorage) rotateChunk(sync bool) error {
+	if sync {
+		if err := me.chunk.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := me.chunk.Close(); err != nil {
+		return err
+	}
+	chunk, err := os.OpenFile(me.getChunkFilename(me.chunkNumber+1), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err = chunk.Truncate(me.chunkSize); err != nil {
+		chunk.Close()
+		return err
+	}
+	me.chunk = chunk
+	me.chunkNumber++
+	me.chunkOffset = 0
+	if sync {
+		return syncDir(me.chunksPath)
+	}
+	return nil
+}
+
+func (me *ChunkDiskStorage) SetDurability(durability Durability) {
+	me.durability = durability
+}
+
+func (me *ChunkDiskStorage) Write(event *StoredEvent) error {
+	return me.WriteBatch([]*StoredEvent{event})
+}
+
+func (me *ChunkDiskStorage) WriteBatch(events []*StoredEvent) error {
+	me.writeLock.Lock()
+	defer me.writeLock.Unlock()
+	if me.closed {
+		return ErrClosed
+	}
+
+	batches := [][]*StoredEvent{events}
+	if me.durability == DURABILITY_FSYNC {
+		batches = make([][]*StoredEvent, len(events))
+		for i, event := range events {
+			batches[i] = []*StoredEvent{event}
+		}
+	}
+	start := me.nextPosition
+	for _, batch := range batches {
+		if err := me.writeBatch(batch); err != nil {
+			if recoveryErr := me.recover(); recoveryErr != nil {
+				fmt.Println("Recovery failed:", recoveryErr)
+			}
+			return batchError(int(me.nextPosition-start), err)
+		}
+	}
+	return nil
+}
+
+// Close releases the current chunk. Writes fail with ErrClosed afterwards.
+func (me *ChunkDiskStorage) Close() error {
+	me.writeLock.Lock()
+	defer me.writeLock.Unlock()
+	if me.closed {
+		return ErrClosed
+	}
+	me.closed = true
+	return me.chunk.Close()
+}
+
+// recover brings the store back to the events of the global index after a
+// failed write, as opening it does after a crash.
+func (me *ChunkDiskStorage) recover() error {
+	// The chunk may already be closed by a failed rotation.
+	me.chunk.Close()
+	if err := me.openLastChunk(); err != nil {
+		return err
+	}
+	return me.repairIndexes()
+}
+
+// writeBatch appends the records to the chunk, then their locations to the
+// indexes. Unless durability is none, indexes are only written once the
+// records are flushed. The events whose location made it to the global index
+// are written, recover completes their other entries.
+func (me *ChunkDiskStorage) writeBatch(events []*StoredEvent) error {
+	sync := me.durability != DURABILITY_NONE
+
+	locations := make([]chunkLocation, len(events))
+	for i, event := range events {
+		record, err := encodeChunkRecord(event, me.nextPosition+uint64(i))
+		if err != nil {
+			return err
+		}
+		if int64(len(record)) > me.chunkSize {
+			return errors.New(fmt.Sprintf("Event too large. Its record takes %v bytes, chunks hold %v.", len(record), me.chunkSize))
+		}
+		if me.chunkOffset+int64(len(record)) > me.chunkSize {
+			if err = me.rotateChunk(sync); err != nil {
+				return err
+			}
+		}
+
+		locations[i] = chunkLocation{me.chunkNumber, me.chunkOffset}
+		written, err := me.chunk.WriteAt(record, me.chunkOffset)
+		if err != nil {
+			return err
+		}
+		if written != len(record) {
+			return errors.New(fmt.Sprintf("Write error. Expected to write %v bytes, wrote only %v.", len(record), written))
+		}
+		me.chunkOffset += int64(written)
+	}
+	if sync {
+		if err := me.chunk.Sync(); err != nil {
+			return err
+		}
+	}
+
+	indexFiles := newAppendFiles()
+	defer indexFiles.close()
+	for i, event := range events {
+		globalIndex, err := indexFiles.open(me.globalIndexFilename)
+		if err != nil {
+			return err
+		}
+		if err = writeLocation(globalIndex, locations[i]); err != nil {
+			return err
+		}
+		me.nextPosition++
+
+		for _, filename := range []string{me.getStreamIndexFilename(event.StreamId), me.getTypeIndexFilename(event.TypeId)} {
+			indexFile, err := indexFiles.open(filename)
+			if err != nil {
+				return err
+			}
+			if err = writeLocation(indexFile, locations[i]); err != nil {
+				return err
+			}
+		}
+	}
+	if sync {
+		return indexFiles.sync()
+	}
+	return nil
+}
+
+func (me *ChunkDiskStorage) StreamVersion(streamId uuid.UUID) (uint32, error) {
+	stat, err := os.Stat(me.getStreamIndexFilename(streamId))
+	if err != nil {
+		return EMPTY_STREAM, errors.New("NOT_FOUND: " + err.Error())
+	}
+	return uint32(stat.Size() / chunkLocationSize), nil
+}
+
+func (me *ChunkDiskStorage) ReadStream(streamId uuid.UUID) ([]*StoredEvent, error) {
+	locations, err := readLocations(me.getStreamIndexFilename(streamId))
+	if err != nil {
+		return nil, errors.New("NOT_FOUND: " + err.Error())
+	}
+
+	reader := me.newChunkReader()
+	defer reader.Close()
+	return reader.readAll(locations)
+}
+
+func (me *ChunkDiskStorage) ReadAll() ([]*StoredEvent, error) {
+	locations, err := readLocations(me.globalIndexFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := me.newChunkReader()
+	defer reader.Close()
+	return reader.readAll(locations)
+}
+
+// RebuildTypeIndexes regenerates the type indexes from the global index into
+// a temporary directory which then replaces the current one. The locations
+// written meanwhile are indexed under the write lock, right before the swap.
+func (me *ChunkDiskStorage) RebuildTypeIndexes() error {
+	me.rebuildLock.Lock()
+	defer me.rebuildLock.Unlock()
+
+	me.writeLock.Lock()
+	total := me.nextPosition
+	me.writeLock.Unlock()
+	fmt.Println("Rebuilding type indexes of", total, "events...")
+
+	rebuildPath := me.typesIndexesPath + ".rebuilding"
+	if err := os.RemoveAll(rebuildPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(rebuildPath, 0777); err != nil {
+		return err
+	}
+
+	reader := me.newChunkReader()
+	defer reader.Close()
+	indexFiles := newAppendFiles()
+	defer indexFiles.close()
+	count := uint64(0)
+	indexLocations := func(locations []chunkLocation) error {
+		for _, location := range locations {
+			event, err := reader.read(location)
+			if err != nil {
+				return err
+			}
+			indexFile, err := indexFiles.open(path.Join(rebuildPath, event.TypeId))
+			if err != nil {
+				return err
+			}
+			if err = writeLocation(indexFile, location); err != nil {
+				return err
+			}
+			count++
+			reportRebuildProgress(count, total)
+		}
+		return nil
+	}
+
+	locations, err := readLocations(me.globalIndexFilename)
+	if err != nil {
+		return err
+	}
+	if err = indexLocations(locations[:total]); err != nil {
+		return err
+	}
+
+	me.writeLock.Lock()
+	defer me.writeLock.Unlock()
+	if locations, err = readLocations(me.globalIndexFilename); err != nil {
+		return err
+	}
+	if err = indexLocations(locations[total:]); err != nil {
+		return err
+	}
+	if err = indexFiles.sync(); err != nil {
+		return err
+	}
+	if err = indexFiles.close(); err != nil {
+		return err
+	}
+	if err = replaceDir(me.typesIndexesPath, rebuildPath); err != nil {
+		return err
+	}
+
+	fmt.Println("Done.", count, "events indexed.")
+	return nil
+}
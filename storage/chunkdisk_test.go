@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/satori/go.uuid"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChunkRotation(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := newChunkDiskStorage(storagePath, 256)
+
+	streamId := uuid.NewV4()
+	written := make([]*StoredEvent, 0)
+	for i := 0; i < 10; i++ {
+		event := &StoredEvent{streamId, time.Now().Round(0), "aType", []byte(fmt.Sprintf("Event %v", i)), "Metadata", []byte("{}")}
+		if err := storage.Write(event); err != nil {
+			t.Errorf("Write failed. Error: %v", err)
+			return
+		}
+		written = append(written, event)
+	}
+
+	//Act
+	storedEvents, err := storage.ReadStream(streamId)
+
+	//Assert
+	if err != nil {
+		t.Errorf("ReadStream failed. Error: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(storedEvents, written) {
+		t.Errorf("ReadStream failed. Got %+v, expected %+v", storedEvents, written)
+	}
+	if storage.chunkNumber == 0 {
+		t.Error("Write failed. Expected records to span several chunks.")
+	}
+	for chunk := uint64(0); chunk <= storage.chunkNumber; chunk++ {
+		if stat, err := os.Stat(storage.getChunkFilename(chunk)); err != nil || stat.Size() != 256 {
+			t.Errorf("Chunk %v isn't 256 bytes. Stat: %v, error: %v", chunk, stat, err)
+		}
+	}
+	if ver, _ := storage.StreamVersion(streamId); ver != 10 {
+		t.Errorf("StreamVersion failed. Got %v, expected %v", ver, 10)
+	}
+}
+
+func TestChunkTornWriteIsTruncatedOnOpen(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := newChunkDiskStorage(storagePath, CHUNK_SIZE)
+
+	streamId := uuid.NewV4()
+	ev1 := &StoredEvent{streamId, time.Now().Round(0), "aType", []byte("1stEvent"), "Metadata", []byte("{}")}
+	storage.Write(ev1)
+	storage.chunk.WriteAt([]byte("garbage from a torn write"), storage.chunkOffset)
+	storage.chunk.Close()
+
+	//Act
+	storage = newChunkDiskStorage(storagePath, CHUNK_SIZE)
+	ev2 := &StoredEvent{streamId, time.Now().Round(0), "aType", []byte("2ndEvent"), "Metadata", []byte("{}")}
+	err := storage.Write(ev2)
+
+	//Assert
+	if err != nil {
+		t.Errorf("Write failed. Error: %v", err)
+		return
+	}
+	storedEvents, err := storage.ReadAll()
+	if err != nil {
+		t.Errorf("ReadAll failed. Error: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(storedEvents, []*StoredEvent{ev1, ev2}) {
+		t.Errorf("ReadAll failed. Got %+v, expected %+v", storedEvents, []*StoredEvent{ev1, ev2})
+	}
+}
+
+func TestChunkIndexesMissingTheLastEventsAreRepairedOnOpen(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := newChunkDiskStorage(storagePath, CHUNK_SIZE)
+
+	streamId := uuid.NewV4()
+	written := make([]*StoredEvent, 0)
+	for i := 0; i < 3; i++ {
+		event := &StoredEvent{streamId, time.Now().Round(0), "aType", []byte(fmt.Sprintf("Event %v", i)), "Metadata", []byte("{}")}
+		storage.Write(event)
+		written = append(written, event)
+	}
+	storage.chunk.Close()
+	// A crash after the global index entries of the last two events lost
+	// their stream index entries, and the type index entry of the last one.
+	os.Truncate(storage.getStreamIndexFilename(streamId), chunkLocationSize+5)
+	os.Truncate(storage.getTypeIndexFilename("aType"), 2*chunkLocationSize)
+
+	//Act
+	storage = newChunkDiskStorage(storagePath, CHUNK_SIZE)
+
+	//Assert
+	storedEvents, err := storage.ReadStream(streamId)
+	if err != nil || !reflect.DeepEqual(storedEvents, written) {
+		t.Errorf("ReadStream failed. Got %+v with error %v, expected %+v", storedEvents, err, written)
+	}
+	typeIndex, _ := readLocations(storage.getTypeIndexFilename("aType"))
+	if len(typeIndex) != 3 {
+		t.Errorf("Repair failed. Type index has %v entries, expected 3", len(typeIndex))
+	}
+	if ver, _ := storage.StreamVersion(streamId); ver != 3 {
+		t.Errorf("StreamVersion failed. Got %v, expected %v", ver, 3)
+	}
+}
+
+func TestChunkChecksumMismatch(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := newChunkDiskStorage(storagePath, CHUNK_SIZE)
+
+	streamId := uuid.NewV4()
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("1stEvent"), "Metadata", []byte("{}")})
+	storage.chunk.WriteAt([]byte("X"), storage.chunkOffset-3)
+
+	//Act
+	_, err := storage.ReadStream(streamId)
+
+	//Assert
+	if err == nil || !strings.Contains(err.Error(), "Checksum mismatch") {
+		t.Errorf("ReadStream failed. Got error %v, expected a checksum mismatch.", err)
+	}
+}
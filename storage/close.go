@@ -0,0 +1,21 @@
+package storage
+
+import "errors"
+
+// ErrClosed is returned by the writes to a closed storage.
+var ErrClosed = errors.New("Storage closed")
+
+// Closer is implemented by the storages holding resources, such as an open
+// database file, to release when the store stops.
+type Closer interface {
+	Close() error
+}
+
+// Close closes storage if it is a Closer.
+func Close(storage Storage) error {
+	closer, ok := storage.(Closer)
+	if !ok {
+		return nil
+	}
+	return closer.Close()
+}
@@ -0,0 +1,55 @@
+package storage_test
+
+import (
+	storage "."
+	"./storagetest"
+	"testing"
+)
+
+func withDurability(newStorage storagetest.Factory, durability storage.Durability) storagetest.Factory {
+	return func(storagePath string) storage.Storage {
+		store := newStorage(storagePath)
+		store.(storage.DurableStorage).SetDurability(durability)
+		return store
+	}
+}
+
+func TestDailyDiskStorageConformance(t *testing.T) {
+	storagetest.Run(t, storage.NewDailyDiskStorage)
+}
+
+func TestDailyDiskStorageConformanceWithFsync(t *testing.T) {
+	storagetest.Run(t, withDurability(storage.NewDailyDiskStorage, storage.DURABILITY_FSYNC))
+}
+
+func TestDailyDiskStorageConformanceWithGroupCommit(t *testing.T) {
+	storagetest.Run(t, withDurability(storage.NewDailyDiskStorage, storage.DURABILITY_GROUP))
+}
+
+func TestGroupCommitStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(storagePath string) storage.Storage {
+		return storage.NewGroupCommitStorage(withDurability(storage.NewDailyDiskStorage, storage.DURABILITY_GROUP)(storagePath))
+	})
+}
+
+func TestSimpleDiskStorageConformance(t *testing.T) {
+	storagetest.Run(t, storage.NewSimpleDiskStorage)
+}
+
+func TestChunkDiskStorageConformance(t *testing.T) {
+	storagetest.Run(t, storage.NewChunkDiskStorage)
+}
+
+func TestChunkDiskStorageConformanceWithGroupCommit(t *testing.T) {
+	storagetest.Run(t, withDurability(storage.NewChunkDiskStorage, storage.DURABILITY_GROUP))
+}
+
+func TestBoltStorageConformance(t *testing.T) {
+	storagetest.Run(t, storage.NewBoltStorage)
+}
+
+func TestInMemoryStorageConformance(t *testing.T) {
+	storagetest.Run(t, func(string) storage.Storage {
+		return storage.NewInMemoryStorage()
+	})
+}
@@ -9,87 +9,224 @@ import (
 	"errors"
 	"io/ioutil"
 	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 const EMPTY_STREAM = uint32(0)
 var CRLF = []byte("\r\n")
 
+// On-disk format of a DailyDiskStorage. Format 1 stores had no format file and
+// named event files after their creation time and type only; format 2 adds the
+// global position to index entries and event filenames; format 3 stores the
+// data, metadata type and metadata of an event as sized fields, as the data
+// can itself contain CRLF; format 4 ends index entries and event files with a
+// CRC32C checksum; format 5 starts event files with their index entry, so the
+// indexes can be rebuilt from the event files alone.
+//
+// Type index lines carry no checksum: they only hold event filenames derived
+// from the checksummed global index and are only read back by backups, which
+// reject malformed lines. Verify reports any line that doesn't match the global
+// index and RebuildTypeIndexes regenerates them.
+const DAILYDISK_FORMAT = 5
+const formatFilename = "format"
+
 type DailyDiskStorage struct {
 	storagePath string
 	indexesPath string
 	typesIndexesPath string
 	globalIndexFilename string
+	journalFilename string
+	format int
+	durability Durability
+	writeLock sync.Mutex
+	rebuildLock sync.Mutex
+	nextPosition uint64
+	tailLock sync.Mutex
+	tail globalOffset
+	readOnly bool
+}
+
+func newDailyDiskStorage(storagePath string) *DailyDiskStorage {
+	storage := &DailyDiskStorage{storagePath: storagePath}
+	storage.setIndexesPath(path.Join(storagePath, "indexes"))
+	return storage
+}
+
+func (me *DailyDiskStorage) setIndexesPath(indexesPath string) {
+	me.indexesPath = indexesPath
+	me.typesIndexesPath = path.Join(indexesPath, "types")
+	me.globalIndexFilename = path.Join(indexesPath, "global")
+	me.journalFilename = path.Join(indexesPath, "pending")
 }
 
 func NewDailyDiskStorage(storagePath string) Storage {
 	fmt.Println("Using DailyDiskStorage path:", storagePath)
-	indexesPath := path.Join(storagePath, "indexes")
-	globalIndexPath := path.Join(indexesPath, "global")
-	typesIndexesPath := path.Join(indexesPath, "types")
-	if err := os.MkdirAll(typesIndexesPath, 0777); err != nil {
+	storage := newDailyDiskStorage(storagePath)
+	if err := recoverReplacedDir(storage.typesIndexesPath); err != nil {
+		panic(err)
+	}
+	if err := os.MkdirAll(storage.typesIndexesPath, 0777); err != nil {
+		panic(err)
+	}
+
+	format, err := readFormat(storagePath, storage.globalIndexFilename, DAILYDISK_FORMAT)
+	if err != nil {
 		panic(err)
 	}
-	return &DailyDiskStorage{storagePath, indexesPath, typesIndexesPath, globalIndexPath};
+	if format > DAILYDISK_FORMAT {
+		panic(fmt.Sprintf("Unsupported storage format %v, this version supports up to %v.", format, DAILYDISK_FORMAT))
+	}
+	storage.format = format
+
+	if format == DAILYDISK_FORMAT {
+		err = storage.recover()
+	} else {
+		storage.nextPosition, err = storage.countGlobalEntries()
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	return storage
 }
 
-func (me DailyDiskStorage) getStreamIndexFilename(streamId uuid.UUID) string {
+// OpenDailyDiskStorageReadOnly opens the DailyDiskStorage at storagePath, e.g.
+// a backup, for reading only: unlike NewDailyDiskStorage it neither creates
+// nor recovers the store, and writing to it fails. A store left with an
+// incomplete index entry by a crash fails to open until it is recovered.
+func OpenDailyDiskStorageReadOnly(storagePath string) (Storage, error) {
+	storage := newDailyDiskStorage(storagePath)
+	format, err := readStoredFormat(storage)
+	if err != nil {
+		return nil, err
+	}
+	if format > DAILYDISK_FORMAT {
+		return nil, errors.New(fmt.Sprintf("Unsupported storage format %v, this version supports up to %v.", format, DAILYDISK_FORMAT))
+	}
+	storage.format = format
+	storage.readOnly = true
+	if storage.nextPosition, err = storage.countGlobalEntries(); err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
+
+// readFormat reads the format of the store at storagePath. A store without a
+// format file is in format 1 if legacyFilename exists, otherwise it is new and
+// gets the current format.
+func readFormat(storagePath string, legacyFilename string, current int) (int, error) {
+	content, err := ioutil.ReadFile(path.Join(storagePath, formatFilename))
+	if err == nil {
+		return strconv.Atoi(strings.TrimSpace(string(content)))
+	}
+	if !os.IsNotExist(err) {
+		return 0, err
+	}
+	if _, err := os.Stat(legacyFilename); err == nil {
+		return 1, nil
+	}
+	err = ioutil.WriteFile(path.Join(storagePath, formatFilename), []byte(strconv.Itoa(current)), 0644)
+	return current, err
+}
+
+func (me *DailyDiskStorage) countGlobalEntries() (uint64, error) {
+	count := uint64(0)
+	err := me.forEachGlobalEntry(func(entry *IndexEntry) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+func (me *DailyDiskStorage) getStreamIndexFilename(streamId uuid.UUID) string {
 	return path.Join(me.indexesPath, streamId.String())
 }
 
-func (me DailyDiskStorage) getEventFilename(creationTime time.Time, typeId string) string {
+func (me *DailyDiskStorage) getEventFilename(entry *IndexEntry) string {
+	creationTime := entry.creationTime
 	yearMonth := fmt.Sprintf("%04d%02d", creationTime.Year(), creationTime.Month())
 	day := fmt.Sprintf("%02d", creationTime.Day())
-	eventFilename := fmt.Sprintf("%02d%02d%02d%09d_%s", creationTime.Hour(), creationTime.Minute(), creationTime.Second(), creationTime.Nanosecond(), typeId)
+	timeOfDay := fmt.Sprintf("%02d%02d%02d%09d", creationTime.Hour(), creationTime.Minute(), creationTime.Second(), creationTime.Nanosecond())
+	eventFilename := fmt.Sprintf("%s_%d_%s", timeOfDay, entry.position, entry.typeId)
+	if me.format == 1 {
+		eventFilename = fmt.Sprintf("%s_%s", timeOfDay, entry.typeId)
+	}
 	return path.Join(me.storagePath, yearMonth, day, eventFilename)
 }
 
 type IndexEntry struct {
 	streamId uuid.UUID
+	position uint64
 	creationTime time.Time
 	typeId string
 }
 
-func appendIndex(filename string, entry *IndexEntry) error {
-	indexFile, err := os.OpenFile(filename, os.O_APPEND | os.O_WRONLY | os.O_CREATE, 0644)
+func encodeIndexEntry(entry *IndexEntry) ([]byte, error) {
+	creationTimeBytes, err := entry.creationTime.MarshalBinary()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer indexFile.Close()
+	content := make([]byte, 16 + IntegerSizeInBytes)
+	copy(content, entry.streamId.Bytes())
+	binary.BigEndian.PutUint64(content[16:], entry.position)
+	content = appendSizedBytes(content, creationTimeBytes)
+	content = appendSizedBytes(content, []byte(entry.typeId))
+	return content, nil
+}
 
-	written, err := indexFile.Write(entry.streamId.Bytes())
+func decodeIndexEntry(content []byte) (*IndexEntry, error) {
+	if len(content) < 16 + IntegerSizeInBytes {
+		return nil, errors.New("Integrity error. Index entry is too short.")
+	}
+	entry := &IndexEntry{streamId: uuid.FromBytesOrNil(content[:16]), position: binary.BigEndian.Uint64(content[16:])}
+	creationTimeBytes, rest, err := takeSizedBytes(content[16 + IntegerSizeInBytes:])
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if written != 16 {
-		return errors.New(fmt.Sprintf("Write error. Expected to write %v bytes, wrote only %v.", 16, written))
+	if err = entry.creationTime.UnmarshalBinary(creationTimeBytes); err != nil {
+		return nil, err
+	}
+	typeIdBytes, _, err := takeSizedBytes(rest)
+	if err != nil {
+		return nil, err
 	}
+	entry.typeId = string(typeIdBytes)
+	return entry, nil
+}
 
-	creationTimeBytes, err := entry.creationTime.MarshalBinary()
+func writeIndexEntry(indexFile *os.File, entry *IndexEntry) error {
+	content, err := encodeIndexEntry(entry)
 	if err != nil {
 		return err
 	}
-	writeSizeAndBytes(indexFile, creationTimeBytes)
-	writeSizeAndBytes(indexFile, []byte(entry.typeId))
-
-	return nil
-}
+	content = appendChecksum(content)
 
-func (me DailyDiskStorage) appendTypeIndex(entry *IndexEntry) error {
-	filename := path.Join(me.typesIndexesPath, entry.typeId)
-	indexFile, err := os.OpenFile(filename, os.O_APPEND | os.O_WRONLY | os.O_CREATE, 0644 )
+	written, err := indexFile.Write(content)
 	if err != nil {
 		return err
 	}
-	defer indexFile.Close()
+	if written != len(content) {
+		return errors.New(fmt.Sprintf("Write error. Expected to write %v bytes, wrote only %v.", len(content), written))
+	}
+	return nil
+}
+
+func (me *DailyDiskStorage) getTypeIndexFilename(typeId string) string {
+	return path.Join(me.typesIndexesPath, typeId)
+}
 
-	value := me.getEventFilename(entry.creationTime, entry.typeId)
+func (me *DailyDiskStorage) writeTypeIndexEntry(indexFile *os.File, entry *IndexEntry) error {
+	value := me.getEventFilename(entry)
 	start := len(me.storagePath) + 1
-	_, err = indexFile.WriteString(value[start:] + "\r\n")
+	_, err := indexFile.WriteString(value[start:] + "\r\n")
 
 	return err
 }
 
-func readIndexNextEntry(f *os.File) (*IndexEntry, error) {
+func readIndexNextEntry(f *os.File, format int) (*IndexEntry, error) {
 	index := IndexEntry{}
 
 	uuidBytes := make([]byte, 16)
@@ -102,6 +239,18 @@ func readIndexNextEntry(f *os.File) (*IndexEntry, error) {
 	}
 	index.streamId = uuid.FromBytesOrNil(uuidBytes)
 
+	if format > 1 {
+		positionBytes := make([]byte, IntegerSizeInBytes)
+		read, err = f.Read(positionBytes)
+		if err != nil {
+			return nil, err
+		}
+		if read != IntegerSizeInBytes {
+			return nil, errors.New(fmt.Sprintf("Integrity error. Expected to read %v bytes, got only %v bytes.", IntegerSizeInBytes, read))
+		}
+		index.position = binary.BigEndian.Uint64(positionBytes)
+	}
+
 	creationTimeBytes, err := readSizedBytes(f)
 	if err != nil {
 		return nil, err
@@ -111,30 +260,111 @@ func readIndexNextEntry(f *os.File) (*IndexEntry, error) {
 	}
 
 	typeIdBytes, err := readSizedBytes(f)
+	if err != nil {
+		return nil, err
+	}
 	index.typeId = string(typeIdBytes)
 
+	if format >= 4 {
+		if err = verifyIndexEntryChecksum(f, &index); err != nil {
+			return nil, err
+		}
+	}
+
 	return &index, nil;
 }
 
-func writeEvent(filename string, data []byte, metadata []byte) error {
-	eventFile, err := os.OpenFile(filename, os.O_APPEND | os.O_WRONLY | os.O_CREATE, 0644)
+// verifyIndexEntryChecksum reads the checksum following entry in f and checks
+// it against the entry as it was read.
+func verifyIndexEntryChecksum(f *os.File, entry *IndexEntry) error {
+	checksum := make([]byte, checksumSize)
+	read, err := f.Read(checksum)
+	if err != nil && err.Error() != "EOF" {
+		return err
+	}
+	if read != checksumSize {
+		return errors.New(fmt.Sprintf("Integrity error. Expected to read %v bytes, got only %v bytes.", checksumSize, read))
+	}
+	content, err := encodeIndexEntry(entry)
+	if err != nil {
+		return err
+	}
+	if validChecksum(content, checksum) {
+		return nil
+	}
+	offset, err := f.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return err
+	}
+	return &CorruptionError{f.Name(), offset - int64(len(content) + checksumSize), "Checksum mismatch"}
+}
+
+func writeEvent(filename string, entry *IndexEntry, event *StoredEvent, sync bool) error {
+	header, err := encodeIndexEntry(entry)
+	if err != nil {
+		return err
+	}
+	eventFile, err := os.OpenFile(filename, os.O_EXCL | os.O_WRONLY | os.O_CREATE, 0644)
 	if err != nil {
 		return err
 	}
 	defer eventFile.Close()
 
-	eventFile.Write(data)
-	eventFile.Write(CRLF)
-	eventFile.Write(metadata)
+	content := appendSizedBytes(nil, header)
+	content = appendSizedBytes(content, event.Data)
+	content = appendSizedBytes(content, []byte(event.MetadataTypeId))
+	content = appendSizedBytes(content, event.Metadata)
+	content = appendChecksum(content)
+	written, err := eventFile.Write(content)
+	if err != nil {
+		return err
+	}
+	if written != len(content) {
+		return errors.New(fmt.Sprintf("Write error. Expected to write %v bytes, wrote only %v.", len(content), written))
+	}
 
+	if sync {
+		return eventFile.Sync()
+	}
 	return nil
 }
 
-func readEvent(filename string) (data []byte, metadata []byte, err error) {
+// readEvent reads an event file. The index entry it starts with is only
+// returned from format 5 on, it is nil before.
+func readEvent(filename string, format int) (header *IndexEntry, data []byte, metadataTypeId string, metadata []byte, err error) {
 	content, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return
 	}
+	if format >= 4 {
+		if len(content) < checksumSize || !validChecksum(content[:len(content) - checksumSize], content[len(content) - checksumSize:]) {
+			err = &CorruptionError{filename, 0, "Checksum mismatch"}
+			return
+		}
+		content = content[:len(content) - checksumSize]
+	}
+	if format >= 5 {
+		var headerBytes []byte
+		if headerBytes, content, err = takeSizedBytes(content); err != nil {
+			return
+		}
+		if header, err = decodeIndexEntry(headerBytes); err != nil {
+			return
+		}
+	}
+	if format >= 3 {
+		var metadataTypeIdBytes []byte
+		if data, content, err = takeSizedBytes(content); err != nil {
+			return
+		}
+		if metadataTypeIdBytes, content, err = takeSizedBytes(content); err != nil {
+			return
+		}
+		metadataTypeId = string(metadataTypeIdBytes)
+		metadata, _, err = takeSizedBytes(content)
+		return
+	}
+	metadataTypeId = "Metadata"
 	sep := bytes.Index(content, CRLF)
 	if sep == -1 {
 		data = content
@@ -146,32 +376,116 @@ func readEvent(filename string) (data []byte, metadata []byte, err error) {
 	return
 }
 
-func (me DailyDiskStorage) Write(event *StoredEvent) error {
+func (me *DailyDiskStorage) SetDurability(durability Durability) {
+	me.durability = durability
+}
 
-	eventFilename := me.getEventFilename(event.CreationTime, event.TypeId)
-	os.MkdirAll(path.Dir(eventFilename), 0777)
+func (me *DailyDiskStorage) Write(event *StoredEvent) error {
+	return me.WriteBatch([]*StoredEvent{event})
+}
 
-	err := writeEvent(eventFilename, event.Data, event.Metadata)
-	if err != nil {
-		return err
+func (me *DailyDiskStorage) WriteBatch(events []*StoredEvent) error {
+	if me.readOnly {
+		return errors.New("Storage is read-only.")
+	}
+	if me.format != DAILYDISK_FORMAT {
+		return errors.New(fmt.Sprintf("Storage format %v is read-only, migrate it to format %v first.", me.format, DAILYDISK_FORMAT))
 	}
 
-	index := &IndexEntry{event.StreamId, event.CreationTime, event.TypeId}
+	me.writeLock.Lock()
+	defer me.writeLock.Unlock()
 
-	err = appendIndex(me.globalIndexFilename, index)
-	if err != nil {
-		return err
+	batches := [][]*StoredEvent{events}
+	if me.durability == DURABILITY_FSYNC {
+		batches = make([][]*StoredEvent, len(events))
+		for i, event := range events {
+			batches[i] = []*StoredEvent{event}
+		}
 	}
+	start := me.nextPosition
+	for _, batch := range batches {
+		if err := me.writeBatch(batch); err != nil {
+			if recoveryErr := me.recover(); recoveryErr != nil {
+				fmt.Println("Recovery failed:", recoveryErr)
+			}
+			return batchError(int(me.nextPosition-start), err)
+		}
+	}
+	return nil
+}
 
-	err = appendIndex(me.getStreamIndexFilename(event.StreamId), index)
-	if err != nil {
+// writeBatch journals the index entries, writes the event files, then appends
+// the index entries. Unless durability is none, indexes are only written once
+// the event files are flushed, so an index never references an event lost in a
+// crash. The journal lets recover complete or roll back an interrupted batch:
+// the events that made it to the global index are written, the others aren't.
+func (me *DailyDiskStorage) writeBatch(events []*StoredEvent) error {
+	sync := me.durability != DURABILITY_NONE
+
+	entries := make([]*IndexEntry, len(events))
+	for i, event := range events {
+		entries[i] = &IndexEntry{event.StreamId, me.nextPosition + uint64(i), event.CreationTime, event.TypeId}
+	}
+	if err := me.writeJournal(entries, sync); err != nil {
 		return err
 	}
 
-	return me.appendTypeIndex(index)
+	eventDirs := make(map[string]bool)
+	for i, event := range events {
+		eventFilename := me.getEventFilename(entries[i])
+		eventDir := path.Dir(eventFilename)
+		if err := os.MkdirAll(eventDir, 0777); err != nil {
+			return err
+		}
+		if err := writeEvent(eventFilename, entries[i], event, sync); err != nil {
+			return err
+		}
+		eventDirs[eventDir] = true
+		eventDirs[path.Dir(eventDir)] = true
+	}
+	if sync {
+		if err := syncDirs(eventDirs); err != nil {
+			return err
+		}
+	}
+
+	indexFiles := newAppendFiles()
+	defer indexFiles.close()
+	for _, entry := range entries {
+		globalIndex, err := indexFiles.open(me.globalIndexFilename)
+		if err != nil {
+			return err
+		}
+		if err = writeIndexEntry(globalIndex, entry); err != nil {
+			return err
+		}
+		me.nextPosition++
+
+		streamIndex, err := indexFiles.open(me.getStreamIndexFilename(entry.streamId))
+		if err != nil {
+			return err
+		}
+		if err = writeIndexEntry(streamIndex, entry); err != nil {
+			return err
+		}
+
+		typeIndex, err := indexFiles.open(me.getTypeIndexFilename(entry.typeId))
+		if err != nil {
+			return err
+		}
+		if err = me.writeTypeIndexEntry(typeIndex, entry); err != nil {
+			return err
+		}
+	}
+	if sync {
+		if err := indexFiles.sync(); err != nil {
+			return err
+		}
+	}
+	return os.Truncate(me.journalFilename, 0)
 }
 
-func (me DailyDiskStorage) StreamVersion(streamId uuid.UUID) (uint32, error) {
+func (me *DailyDiskStorage) StreamVersion(streamId uuid.UUID) (uint32, error) {
 	indexFile, err := os.OpenFile(me.getStreamIndexFilename(streamId), os.O_RDONLY, 0)
 	if err != nil {
 		return EMPTY_STREAM, errors.New("NOT_FOUND: " + err.Error())
@@ -180,7 +494,7 @@ func (me DailyDiskStorage) StreamVersion(streamId uuid.UUID) (uint32, error) {
 
 	ver := EMPTY_STREAM
 	for {
-		_, err := readIndexNextEntry(indexFile)
+		_, err := readIndexNextEntry(indexFile, me.format)
 		if err != nil && err.Error() == "EOF" {
 			break
 		}
@@ -193,7 +507,7 @@ func (me DailyDiskStorage) StreamVersion(streamId uuid.UUID) (uint32, error) {
 	return ver, nil
 }
 
-func (me DailyDiskStorage) ReadStream(streamId uuid.UUID) ([]*StoredEvent, error) {
+func (me *DailyDiskStorage) ReadStream(streamId uuid.UUID) ([]*StoredEvent, error) {
 
 	indexFile, err := os.OpenFile(me.getStreamIndexFilename(streamId), os.O_RDONLY, 0)
 	if err != nil {
@@ -203,78 +517,151 @@ func (me DailyDiskStorage) ReadStream(streamId uuid.UUID) ([]*StoredEvent, error
 
 	events := make([]*StoredEvent, 0)
 	for {
-		indexEntry, err := readIndexNextEntry(indexFile)
+		indexEntry, err := readIndexNextEntry(indexFile, me.format)
 		if err != nil && err.Error() == "EOF" {
 			break
 		}
 		if err != nil {
 			return nil, err
 		}
-		data, metadata, err := readEvent(me.getEventFilename(indexEntry.creationTime, indexEntry.typeId))
+		event, err := me.readStoredEvent(indexEntry)
 		if err != nil {
 			return nil, err
 		}
-		event := &StoredEvent{streamId, indexEntry.creationTime, indexEntry.typeId, data, "Metadata", metadata}
 		events = append(events, event)
 	}
 
 	return events, nil
 }
 
-func (me DailyDiskStorage) ReadAll() ([]*StoredEvent, error) {
+func (me *DailyDiskStorage) forEachGlobalEntry(fn func(*IndexEntry) error) error {
 	indexFile, err := os.OpenFile(me.globalIndexFilename, os.O_RDONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer indexFile.Close()
 
-	events := make([]*StoredEvent, 0)
 	for {
-		indexEntry, err := readIndexNextEntry(indexFile)
+		indexEntry, err := readIndexNextEntry(indexFile, me.format)
 		if err != nil && err.Error() == "EOF" {
-			break
+			return nil
 		}
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err = fn(indexEntry); err != nil {
+			return err
 		}
-		data, metadata, err := readEvent(me.getEventFilename(indexEntry.creationTime, indexEntry.typeId))
+	}
+}
+
+func (me *DailyDiskStorage) readStoredEvent(indexEntry *IndexEntry) (*StoredEvent, error) {
+	_, data, metadataTypeId, metadata, err := readEvent(me.getEventFilename(indexEntry), me.format)
+	if err != nil {
+		return nil, err
+	}
+	return &StoredEvent{indexEntry.streamId, indexEntry.creationTime, indexEntry.typeId, data, metadataTypeId, metadata}, nil
+}
+
+func (me *DailyDiskStorage) ReadAll() ([]*StoredEvent, error) {
+	events := make([]*StoredEvent, 0)
+	err := me.forEachGlobalEntry(func(indexEntry *IndexEntry) error {
+		event, err := me.readStoredEvent(indexEntry)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		event := &StoredEvent{indexEntry.streamId, indexEntry.creationTime, indexEntry.typeId, data, "Metadata", metadata}
 		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return events, nil
 }
 
-func (me DailyDiskStorage) RebuildTypeIndexes() {
-	fmt.Print("Rebuilding type indexes... ")
+// RebuildTypeIndexes regenerates the type indexes from the global index into
+// a temporary directory which then replaces the current one. Writes go on
+// during the rebuild: the entries they add to the global index are indexed
+// under the write lock, right before the swap.
+func (me *DailyDiskStorage) RebuildTypeIndexes() error {
+	if me.readOnly {
+		return errors.New("Storage is read-only.")
+	}
+	me.rebuildLock.Lock()
+	defer me.rebuildLock.Unlock()
 
-	err := os.RemoveAll(me.typesIndexesPath)
-	if err != nil {
-		panic(err)
+	me.writeLock.Lock()
+	total := me.nextPosition
+	me.writeLock.Unlock()
+	fmt.Println("Rebuilding type indexes of", total, "events...")
+
+	rebuildPath := me.typesIndexesPath + ".rebuilding"
+	if err := os.RemoveAll(rebuildPath); err != nil {
+		return err
 	}
-	err = os.MkdirAll(me.typesIndexesPath, 0644)
-	if err != nil {
-		panic(err)
+	if err := os.MkdirAll(rebuildPath, 0777); err != nil {
+		return err
 	}
 
-	globalIndexFile, err := os.OpenFile(me.globalIndexFilename, os.O_RDONLY, 0)
+	globalIndexFile, err := os.OpenFile(me.globalIndexFilename, os.O_RDONLY|os.O_CREATE, 0644)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer globalIndexFile.Close()
+
+	indexFiles := newAppendFiles()
+	defer indexFiles.close()
+	count := uint64(0)
+	indexEntry := func(entry *IndexEntry) error {
+		indexFile, err := indexFiles.open(path.Join(rebuildPath, entry.typeId))
+		if err != nil {
+			return err
+		}
+		if err = me.writeTypeIndexEntry(indexFile, entry); err != nil {
+			return err
+		}
+		count++
+		reportRebuildProgress(count, total)
+		return nil
+	}
+	for count < total {
+		entry, err := readIndexNextEntry(globalIndexFile, me.format)
+		if err != nil {
+			return err
+		}
+		if err = indexEntry(entry); err != nil {
+			return err
+		}
 	}
 
+	me.writeLock.Lock()
+	defer me.writeLock.Unlock()
 	for {
-		indexEntry, err := readIndexNextEntry(globalIndexFile)
+		entry, err := readIndexNextEntry(globalIndexFile, me.format)
 		if err != nil && err.Error() == "EOF" {
 			break
 		}
 		if err != nil {
-			panic(err)
+			return err
+		}
+		if err = indexEntry(entry); err != nil {
+			return err
 		}
-		me.appendTypeIndex(indexEntry)
+	}
+	if err = indexFiles.sync(); err != nil {
+		return err
+	}
+	if err = indexFiles.close(); err != nil {
+		return err
+	}
+	if err = replaceDir(me.typesIndexesPath, rebuildPath); err != nil {
+		return err
 	}
 
-	fmt.Println("Done.")
-}
\ No newline at end of file
+	fmt.Println("Done.", count, "events indexed.")
+	return nil
+}
@@ -7,6 +7,9 @@ import (
 	"github.com/satori/go.uuid"
 	"time"
 	"reflect"
+	"sync"
+	"fmt"
+	"io/ioutil"
 )
 
 func TestAddEvent(t *testing.T) {
@@ -40,7 +43,7 @@ func TestAddEvent(t *testing.T) {
 	if aggregateIndexFi == nil {
 		t.Errorf("Write failed. Expected index for aggregate %v, none exists.", aggregateId.String())
 	}
-	eventFi, _ := os.Stat(readableDiskStorage.getEventFilename(aTime, aType))
+	eventFi, _ := os.Stat(readableDiskStorage.getEventFilename(&IndexEntry{aggregateId, 0, aTime, aType}))
 	if eventFi == nil {
 		t.Errorf("Write failed. Expected file for event %v, none exists.", aggregateId.String())
 	}
@@ -55,9 +58,9 @@ func TestReadStream(t *testing.T) {
 	storage := NewDailyDiskStorage(storagePath)
 
 	streamId := uuid.NewV4()
-	ev1 := &StoredEvent{streamId, time.Now(), "1stType", []byte("1stEvent"), "Metadata", []byte("{}")}
+	ev1 := &StoredEvent{streamId, time.Now().Round(0), "1stType", []byte("1stEvent"), "Metadata", []byte("{}")}
 	storage.Write(ev1)
-	ev2 := &StoredEvent{streamId, time.Now(), "2ndType", []byte("2ndEvent"), "Metadata", []byte("{}")}
+	ev2 := &StoredEvent{streamId, time.Now().Round(0), "2ndType", []byte("2ndEvent"), "Metadata", []byte("{}")}
 	storage.Write(ev2)
 
 	//Act
@@ -90,11 +93,11 @@ func TestReadAll(t *testing.T) {
 
 	stream1Id := uuid.NewV4()
 	stream2Id := uuid.NewV4()
-	ev1 := &StoredEvent{stream1Id, time.Now(), "1stType", []byte("1stEvent"), "Metadata", []byte("{}")}
+	ev1 := &StoredEvent{stream1Id, time.Now().Round(0), "1stType", []byte("1stEvent"), "Metadata", []byte("{}")}
 	storage.Write(ev1)
-	ev2 := &StoredEvent{stream2Id, time.Now(), "2ndType", []byte("2ndEvent"), "Metadata", []byte("{}")}
+	ev2 := &StoredEvent{stream2Id, time.Now().Round(0), "2ndType", []byte("2ndEvent"), "Metadata", []byte("{}")}
 	storage.Write(ev2)
-	ev3 := &StoredEvent{stream1Id, time.Now(), "3rdType", []byte("3rdEvent"), "Metadata", []byte("{}")}
+	ev3 := &StoredEvent{stream1Id, time.Now().Round(0), "3rdType", []byte("3rdEvent"), "Metadata", []byte("{}")}
 	storage.Write(ev3)
 
 	//Act
@@ -122,3 +125,138 @@ func TestReadAll(t *testing.T) {
 		return
 	}
 }
+
+func TestConcurrentWritesWithSameCreationTime(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewDailyDiskStorage(storagePath)
+
+	aTime := time.Date(2016,2,11,9,53,32,1234567, time.UTC)
+	writers := 16
+	eventsPerWriter := 32
+	streamIds := make([]uuid.UUID, writers)
+	errs := make(chan error, writers * eventsPerWriter)
+
+	//Act
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		streamIds[i] = uuid.NewV4()
+		wg.Add(1)
+		go func(writer int, streamId uuid.UUID) {
+			defer wg.Done()
+			for j := 0; j < eventsPerWriter; j++ {
+				data := []byte(fmt.Sprintf("%v-%v", writer, j))
+				if err := storage.Write(&StoredEvent{streamId, aTime, "sameType", data, "Metadata", []byte("{}")}); err != nil {
+					errs <- err
+				}
+			}
+		}(i, streamIds[i])
+	}
+	wg.Wait()
+	close(errs)
+
+	//Assert
+	for err := range errs {
+		t.Errorf("Write failed. Error: %v", err)
+	}
+	storedEvents, err := storage.ReadAll()
+	if err != nil {
+		t.Errorf("ReadAll failed. Error: %v", err)
+		return
+	}
+	if len(storedEvents) != writers * eventsPerWriter {
+		t.Errorf("ReadAll failed. Got %v stored events, expected %v", len(storedEvents), writers * eventsPerWriter)
+		return
+	}
+	seen := make(map[string]bool)
+	for _, storedEvent := range storedEvents {
+		if seen[string(storedEvent.Data)] {
+			t.Errorf("ReadAll failed. Event %s returned twice.", storedEvent.Data)
+		}
+		seen[string(storedEvent.Data)] = true
+		if string(storedEvent.Metadata) != "{}" {
+			t.Errorf("ReadAll failed. Event %s has metadata %q, expected %q", storedEvent.Data, storedEvent.Metadata, "{}")
+		}
+	}
+	for i, streamId := range streamIds {
+		storedEvents, err := storage.ReadStream(streamId)
+		if err != nil {
+			t.Errorf("ReadStream failed. Error: %v", err)
+			return
+		}
+		if len(storedEvents) != eventsPerWriter {
+			t.Errorf("ReadStream failed. Got %v stored events, expected %v", len(storedEvents), eventsPerWriter)
+			return
+		}
+		for j, storedEvent := range storedEvents {
+			expected := fmt.Sprintf("%v-%v", i, j)
+			if string(storedEvent.Data) != expected {
+				t.Errorf("ReadStream failed. Event %v is %s, expected %s", j, storedEvent.Data, expected)
+			}
+		}
+	}
+}
+
+func writeFormat1Event(t *testing.T, storagePath string, event *StoredEvent) {
+	eventFilename := path.Join(storagePath, event.CreationTime.Format("200601"), event.CreationTime.Format("02"),
+		fmt.Sprintf("%s%09d_%s", event.CreationTime.Format("150405"), event.CreationTime.Nanosecond(), event.TypeId))
+	os.MkdirAll(path.Dir(eventFilename), 0777)
+	if err := ioutil.WriteFile(eventFilename, append(append(event.Data, CRLF...), event.Metadata...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, indexFilename := range []string{"global", event.StreamId.String()} {
+		indexFile, err := os.OpenFile(path.Join(storagePath, "indexes", indexFilename), os.O_APPEND | os.O_WRONLY | os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		creationTimeBytes, _ := event.CreationTime.MarshalBinary()
+		indexFile.Write(event.StreamId.Bytes())
+		writeSizeAndBytes(indexFile, creationTimeBytes)
+		writeSizeAndBytes(indexFile, []byte(event.TypeId))
+		indexFile.Close()
+	}
+}
+
+func TestMigrateFormat1Storage(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	defer os.RemoveAll(storagePath + ".format1")
+	os.MkdirAll(path.Join(storagePath, "indexes"), 0777)
+
+	streamId := uuid.NewV4()
+	ev1 := &StoredEvent{streamId, time.Date(2016,2,11,9,53,32,1234567, time.UTC), "1stType", []byte("1stEvent"), "Metadata", []byte("{}")}
+	ev2 := &StoredEvent{streamId, time.Date(2016,2,12,10,0,0,0, time.UTC), "2ndType", []byte("2ndEvent"), "Metadata", []byte("{}")}
+	writeFormat1Event(t, storagePath, ev1)
+	writeFormat1Event(t, storagePath, ev2)
+
+	legacy := NewDailyDiskStorage(storagePath)
+	if err := legacy.Write(ev1); err == nil {
+		t.Error("Write succeeded on a format 1 storage, expected an error.")
+	}
+
+	//Act
+	err := MigrateDailyDiskStorage(storagePath)
+
+	//Assert
+	if err != nil {
+		t.Errorf("Migrate failed. Error: %v", err)
+		return
+	}
+	storage := NewDailyDiskStorage(storagePath)
+	if format := storage.(*DailyDiskStorage).format; format != DAILYDISK_FORMAT {
+		t.Errorf("Migrate failed. Storage is in format %v, expected %v", format, DAILYDISK_FORMAT)
+	}
+	storedEvents, err := storage.ReadStream(streamId)
+	if err != nil {
+		t.Errorf("ReadStream failed. Error: %v", err)
+		return
+	}
+	if len(storedEvents) != 2 || !reflect.DeepEqual(storedEvents[0], ev1) || !reflect.DeepEqual(storedEvents[1], ev2) {
+		t.Errorf("Migrate failed. Got %+v, expected %+v and %+v", storedEvents, ev1, ev2)
+	}
+	if err := storage.Write(ev1); err != nil {
+		t.Errorf("Write failed after migration. Error: %v", err)
+	}
+}
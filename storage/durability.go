@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+)
+
+// Durability tells a storage when written files are flushed to stable storage.
+type Durability int
+
+const (
+	// Flushing is left to the operating system.
+	DURABILITY_NONE Durability = iota
+	// Every event is flushed, event file first then indexes, before Write returns.
+	DURABILITY_FSYNC
+	// A batch of events is flushed at once, event files first then indexes.
+	DURABILITY_GROUP
+)
+
+var durabilityNames = map[Durability]string{
+	DURABILITY_NONE:  "none",
+	DURABILITY_FSYNC: "fsync",
+	DURABILITY_GROUP: "group",
+}
+
+func (me Durability) String() string {
+	return durabilityNames[me]
+}
+
+func ParseDurability(name string) (Durability, error) {
+	for durability, durabilityName := range durabilityNames {
+		if durabilityName == name {
+			return durability, nil
+		}
+	}
+	return DURABILITY_NONE, errors.New(fmt.Sprintf("Unknown durability %q, expected none, fsync or group.", name))
+}
+
+// DurableStorage is implemented by the storages whose durability can be configured.
+type DurableStorage interface {
+	SetDurability(durability Durability)
+}
+
+// BatchWriter is implemented by the storages that can write several events
+// with a single flush. When WriteBatch fails, either none of the events were
+// written or it returns a BatchError telling how many were.
+type BatchWriter interface {
+	WriteBatch(events []*StoredEvent) error
+}
+
+// BatchError is returned by WriteBatch when only the first Written events of
+// the batch were written before Err.
+type BatchError struct {
+	Written int
+	Err     error
+}
+
+func (me *BatchError) Error() string {
+	return me.Err.Error()
+}
+
+func (me *BatchError) Unwrap() error {
+	return me.Err
+}
+
+func batchError(written int, err error) error {
+	if written == 0 {
+		return err
+	}
+	return &BatchError{written, err}
+}
+
+// appendFiles keeps the files appended to during a write open, so they can be
+// flushed together or rolled back.
+type appendFiles struct {
+	files map[string]*os.File
+	sizes map[string]int64
+}
+
+// notCreated is the size of a file that didn't exist before a write.
+const notCreated = int64(-1)
+
+func newAppendFiles() *appendFiles {
+	return &appendFiles{make(map[string]*os.File), make(map[string]int64)}
+}
+
+func (me *appendFiles) open(filename string) (*os.File, error) {
+	if file := me.files[filename]; file != nil {
+		return file, nil
+	}
+	size := notCreated
+	if stat, err := os.Stat(filename); err == nil {
+		size = stat.Size()
+	}
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	me.files[filename] = file
+	me.sizes[filename] = size
+	return file, nil
+}
+
+// rollback closes the files and brings them back to their size before the
+// write, removing those it created.
+func (me *appendFiles) rollback() error {
+	if err := me.close(); err != nil {
+		return err
+	}
+	for filename, size := range me.sizes {
+		var err error
+		if size == notCreated {
+			err = os.Remove(filename)
+		} else {
+			err = os.Truncate(filename, size)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(me.sizes, filename)
+	}
+	return nil
+}
+
+// sync flushes the files and the directories holding them, so that newly
+// created files are durable too.
+func (me *appendFiles) sync() error {
+	dirs := make(map[string]bool)
+	for filename, file := range me.files {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+		dirs[path.Dir(filename)] = true
+	}
+	return syncDirs(dirs)
+}
+
+func (me *appendFiles) close() error {
+	var err error
+	for filename, file := range me.files {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		delete(me.files, filename)
+	}
+	return err
+}
+
+func syncDirs(dirs map[string]bool) error {
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	// Directories can't be flushed on Windows, their entries are durable once
+	// the files are.
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+)
+
+// Upper bound on the number of events flushed together.
+const GROUP_COMMIT_MAX_BATCH = 256
+
+// GroupCommitStorage funnels the writes of concurrent clients through a single
+// writer. Writes queued while a batch is being flushed form the next batch, so
+// they share one flush of the event files and indexes. Reads go straight to
+// the underlying storage.
+type GroupCommitStorage struct {
+	Storage
+	writer   BatchWriter
+	requests chan *writeRequest
+	stopped  chan struct{}
+	lock     sync.RWMutex
+	closed   bool
+}
+
+type writeRequest struct {
+	event *StoredEvent
+	done  chan error
+}
+
+// NewGroupCommitStorage returns storage unchanged if it can't write batches.
+func NewGroupCommitStorage(storage Storage) Storage {
+	writer, ok := storage.(BatchWriter)
+	if !ok {
+		return storage
+	}
+	groupCommit := &GroupCommitStorage{Storage: storage, writer: writer, requests: make(chan *writeRequest, GROUP_COMMIT_MAX_BATCH), stopped: make(chan struct{})}
+	go groupCommit.run()
+	return groupCommit
+}
+
+// Write returns once the batch holding event is flushed. If the batch fails,
+// the writes the underlying storage reports as done succeed and the others get
+// the error.
+func (me *GroupCommitStorage) Write(event *StoredEvent) error {
+	request := &writeRequest{event, make(chan error, 1)}
+	me.lock.RLock()
+	if me.closed {
+		me.lock.RUnlock()
+		return ErrClosed
+	}
+	me.requests <- request
+	me.lock.RUnlock()
+	return <-request.done
+}
+
+func (me *GroupCommitStorage) run() {
+	defer close(me.stopped)
+	for request := range me.requests {
+		batch := []*writeRequest{request}
+	collect:
+		for len(batch) < GROUP_COMMIT_MAX_BATCH {
+			select {
+			case request := <-me.requests:
+				batch = append(batch, request)
+			default:
+				break collect
+			}
+		}
+
+		events := make([]*StoredEvent, len(batch))
+		for i, request := range batch {
+			events[i] = request.event
+		}
+		err := me.writer.WriteBatch(events)
+		written := 0
+		if batchErr, ok := err.(*BatchError); ok {
+			written, err = batchErr.Written, batchErr.Err
+		}
+		for i, request := range batch {
+			if i < written {
+				request.done <- nil
+			} else {
+				request.done <- err
+			}
+		}
+	}
+}
+
+// Close returns once the queued writes are done, then closes the underlying
+// storage. Writes afterwards fail with ErrClosed.
+func (me *GroupCommitStorage) Close() error {
+	me.lock.Lock()
+	if me.closed {
+		me.lock.Unlock()
+		return ErrClosed
+	}
+	me.closed = true
+	close(me.requests)
+	me.lock.Unlock()
+	<-me.stopped
+	return Close(me.Storage)
+}
+
+// Backup forwards to the underlying storage, which serializes it with writes.
+func (me *GroupCommitStorage) Backup(target BackupTarget) (uint64, error) {
+	backupStorage, ok := me.Storage.(BackupStorage)
+	if !ok {
+		return 0, errors.New("Backup isn't supported by this storage.")
+	}
+	return backupStorage.Backup(target)
+}
+
+// ReadAllFrom forwards to the underlying storage, reading all events when it
+// can't read from a position.
+func (me *GroupCommitStorage) ReadAllFrom(position uint64) ([]*StoredEvent, error) {
+	return ReadAllFrom(me.Storage, position)
+}
+
+// ReadRange forwards to the underlying storage.
+func (me *GroupCommitStorage) ReadRange(position uint64, count int) ([]*StoredEvent, error) {
+	return ReadRange(me.Storage, position, count)
+}
+
+// EventCount forwards to the underlying storage.
+func (me *GroupCommitStorage) EventCount() (uint64, error) {
+	return EventCount(me.Storage)
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"errors"
+	"github.com/satori/go.uuid"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+type blockingBatchWriter struct {
+	Storage
+	batches chan int
+	release chan bool
+}
+
+func (me *blockingBatchWriter) WriteBatch(events []*StoredEvent) error {
+	me.batches <- len(events)
+	<-me.release
+	for _, event := range events {
+		if err := me.Storage.Write(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestGroupCommitBatchesConcurrentWrites(t *testing.T) {
+	//Arrange
+	writer := &blockingBatchWriter{NewInMemoryStorage(), make(chan int, 2), make(chan bool)}
+	storage := NewGroupCommitStorage(writer).(*GroupCommitStorage)
+	defer storage.Close()
+	streamId := uuid.NewV4()
+	writers := 10
+
+	//Act
+	var wg sync.WaitGroup
+	write := func() {
+		defer wg.Done()
+		if err := storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("{}"), "", nil}); err != nil {
+			t.Errorf("Write failed. Error: %v", err)
+		}
+	}
+	wg.Add(1)
+	go write()
+	first := <-writer.batches
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go write()
+	}
+	for len(storage.requests) < writers {
+		time.Sleep(time.Millisecond)
+	}
+	writer.release <- true
+	second := <-writer.batches
+	writer.release <- true
+	wg.Wait()
+
+	//Assert
+	if first != 1 || second != writers {
+		t.Errorf("Write failed. Got batches of %v and %v events, expected %v and %v", first, second, 1, writers)
+	}
+	if ver, _ := storage.StreamVersion(streamId); ver != uint32(writers+1) {
+		t.Errorf("StreamVersion failed. Got %v, expected %v", ver, writers+1)
+	}
+}
+
+type closingBatchWriter struct {
+	Storage
+	closed bool
+}
+
+func (me *closingBatchWriter) WriteBatch(events []*StoredEvent) error {
+	for _, event := range events {
+		if err := me.Storage.Write(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (me *closingBatchWriter) Close() error {
+	me.closed = true
+	return nil
+}
+
+func TestGroupCommitCloseClosesTheUnderlyingStorage(t *testing.T) {
+	//Arrange
+	writer := &closingBatchWriter{Storage: NewInMemoryStorage()}
+	storage := NewGroupCommitStorage(writer)
+	streamId := uuid.NewV4()
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("{}"), "", nil})
+
+	//Act
+	err := Close(storage)
+
+	//Assert
+	if err != nil || !writer.closed {
+		t.Errorf("Close failed. Error: %v, underlying storage closed: %v", err, writer.closed)
+	}
+	if ver, _ := writer.StreamVersion(streamId); ver != 1 {
+		t.Errorf("StreamVersion failed. Got %v, expected %v", ver, 1)
+	}
+}
+
+type halfBatchWriter struct {
+	blockingBatchWriter
+}
+
+func (me *halfBatchWriter) WriteBatch(events []*StoredEvent) error {
+	written := len(events) / 2
+	if err := me.blockingBatchWriter.WriteBatch(events[:written]); err != nil {
+		return err
+	}
+	return &BatchError{written, errors.New("Disk full")}
+}
+
+func TestGroupCommitReportsTheWritesOfAFailedBatch(t *testing.T) {
+	//Arrange
+	writer := &halfBatchWriter{blockingBatchWriter{NewInMemoryStorage(), make(chan int, 2), make(chan bool)}}
+	storage := NewGroupCommitStorage(writer).(*GroupCommitStorage)
+	defer storage.Close()
+	writers := 4
+	streamIds := make(map[error][]uuid.UUID)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	write := func() {
+		defer wg.Done()
+		streamId := uuid.NewV4()
+		err := storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("{}"), "", nil})
+		lock.Lock()
+		streamIds[err] = append(streamIds[err], streamId)
+		lock.Unlock()
+	}
+
+	//Act
+	wg.Add(1)
+	go write()
+	<-writer.batches
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go write()
+	}
+	for len(storage.requests) < writers {
+		time.Sleep(time.Millisecond)
+	}
+	writer.release <- true
+	<-writer.batches
+	writer.release <- true
+	wg.Wait()
+
+	//Assert
+	if len(streamIds[nil]) != writers/2 {
+		t.Errorf("Write failed. %v writes succeeded, expected %v", len(streamIds[nil]), writers/2)
+	}
+	for err, ids := range streamIds {
+		for _, streamId := range ids {
+			ver, _ := storage.StreamVersion(streamId)
+			if (err == nil) != (ver == 1) {
+				t.Errorf("Write of stream %v returned %v, but its version is %v", streamId, err, ver)
+			}
+		}
+	}
+}
+
+func TestGroupCommitWriteAfterCloseFails(t *testing.T) {
+	//Arrange
+	storage := NewGroupCommitStorage(&closingBatchWriter{Storage: NewInMemoryStorage()})
+	Close(storage)
+
+	//Act
+	err := storage.Write(&StoredEvent{uuid.NewV4(), time.Now(), "aType", []byte("{}"), "", nil})
+
+	//Assert
+	if err != ErrClosed {
+		t.Errorf("Write after Close returned %v, expected %v", err, ErrClosed)
+	}
+}
+
+func benchmarkConcurrentWrites(b *testing.B, durability Durability, groupCommit bool) {
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	diskStorage := NewDailyDiskStorage(storagePath)
+	diskStorage.(DurableStorage).SetDurability(durability)
+	storage := diskStorage
+	if groupCommit {
+		storage = NewGroupCommitStorage(diskStorage)
+		defer storage.(*GroupCommitStorage).Close()
+	}
+	data := []byte(`{"A":1024,"B":"Benchmark"}`)
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		streamId := uuid.NewV4()
+		for pb.Next() {
+			if err := storage.Write(&StoredEvent{streamId, time.Now(), "aType", data, "", nil}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkConcurrentWritesWithoutSync(b *testing.B) {
+	benchmarkConcurrentWrites(b, DURABILITY_NONE, false)
+}
+
+func BenchmarkConcurrentWritesWithFsync(b *testing.B) {
+	benchmarkConcurrentWrites(b, DURABILITY_FSYNC, false)
+}
+
+func BenchmarkConcurrentWritesWithGroupCommit(b *testing.B) {
+	benchmarkConcurrentWrites(b, DURABILITY_GROUP, true)
+}
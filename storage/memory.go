@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"sync"
+)
+
+// InMemoryStorage keeps events, stream indexes and type indexes in memory. It
+// is meant for tests and ephemeral use, and is the reference implementation
+// of the Storage contract.
+type InMemoryStorage struct {
+	lock    sync.RWMutex
+	events  []*StoredEvent
+	streams map[uuid.UUID][]int
+	types   map[string][]int
+}
+
+func NewInMemoryStorage() Storage {
+	return &InMemoryStorage{
+		events:  make([]*StoredEvent, 0),
+		streams: make(map[uuid.UUID][]int),
+		types:   make(map[string][]int),
+	}
+}
+
+func copyStoredEvent(event *StoredEvent) *StoredEvent {
+	copied := *event
+	copied.Data = append([]byte{}, event.Data...)
+	copied.Metadata = append([]byte{}, event.Metadata...)
+	return &copied
+}
+
+func (me *InMemoryStorage) Write(event *StoredEvent) error {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	position := len(me.events)
+	me.events = append(me.events, copyStoredEvent(event))
+	me.streams[event.StreamId] = append(me.streams[event.StreamId], position)
+	me.types[event.TypeId] = append(me.types[event.TypeId], position)
+	return nil
+}
+
+func (me *InMemoryStorage) StreamVersion(streamId uuid.UUID) (uint32, error) {
+	me.lock.RLock()
+	defer me.lock.RUnlock()
+
+	stream, ok := me.streams[streamId]
+	if !ok {
+		return EMPTY_STREAM, errors.New("NOT_FOUND: stream " + streamId.String())
+	}
+	return uint32(len(stream)), nil
+}
+
+func (me *InMemoryStorage) ReadStream(streamId uuid.UUID) ([]*StoredEvent, error) {
+	me.lock.RLock()
+	defer me.lock.RUnlock()
+
+	stream, ok := me.streams[streamId]
+	if !ok {
+		return nil, errors.New("NOT_FOUND: stream " + streamId.String())
+	}
+	results := make([]*StoredEvent, 0, len(stream))
+	for _, position := range stream {
+		results = append(results, copyStoredEvent(me.events[position]))
+	}
+	return results, nil
+}
+
+func (me *InMemoryStorage) ReadAll() ([]*StoredEvent, error) {
+	me.lock.RLock()
+	defer me.lock.RUnlock()
+
+	results := make([]*StoredEvent, 0, len(me.events))
+	for _, event := range me.events {
+		results = append(results, copyStoredEvent(event))
+	}
+	return results, nil
+}
+
+func (me *InMemoryStorage) RebuildTypeIndexes() error {
+	fmt.Print("Rebuilding type indexes... ")
+
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	me.types = make(map[string][]int)
+	for position, event := range me.events {
+		me.types[event.TypeId] = append(me.types[event.TypeId], position)
+	}
+
+	fmt.Println("Done.")
+	return nil
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+)
+
+// MigrateDailyDiskStorage upgrades the DailyDiskStorage at storagePath to the
+// current format. Events are replayed in global order into a new store which
+// then takes the place of the old one; the old store is kept next to it.
+func MigrateDailyDiskStorage(storagePath string) error {
+	storagePath = path.Clean(storagePath)
+	source := NewDailyDiskStorage(storagePath).(*DailyDiskStorage)
+	if source.format == DAILYDISK_FORMAT {
+		fmt.Println("Storage is already in format", DAILYDISK_FORMAT)
+		return nil
+	}
+
+	backupPath := fmt.Sprintf("%s.format%d", storagePath, source.format)
+	if _, err := os.Stat(backupPath); err == nil {
+		return errors.New(fmt.Sprintf("Backup path %s already exists.", backupPath))
+	}
+	targetPath := storagePath + ".migrating"
+	if err := os.RemoveAll(targetPath); err != nil {
+		return err
+	}
+	target := NewDailyDiskStorage(targetPath)
+
+	fmt.Printf("Migrating storage from format %v to %v... ", source.format, DAILYDISK_FORMAT)
+	references := make(map[string]int)
+	migrated := 0
+	err := source.forEachGlobalEntry(func(entry *IndexEntry) error {
+		filename := source.getEventFilename(entry)
+		references[filename]++
+		event, err := source.readStoredEvent(entry)
+		if err != nil {
+			return err
+		}
+		migrated++
+		return target.Write(event)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Done.", migrated, "events migrated.")
+
+	for filename, count := range references {
+		if count > 1 {
+			fmt.Printf("Warning: %s was shared by %v events written in the same nanosecond, their contents were merged and each was migrated with the merged content.\n", filename, count)
+		}
+	}
+
+	if err := os.Rename(storagePath, backupPath); err != nil {
+		return err
+	}
+	if err := os.Rename(targetPath, storagePath); err != nil {
+		return err
+	}
+	fmt.Println("Previous storage kept in", backupPath)
+
+	return nil
+}
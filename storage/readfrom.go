@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"os"
+)
+
+// PositionReader is implemented by storages that can read the events from a
+// global position on without reading those before it.
+type PositionReader interface {
+	ReadAllFrom(position uint64) ([]*StoredEvent, error)
+}
+
+// ReadAllFrom reads the events of storage from position on, through
+// PositionReader when the storage implements it.
+func ReadAllFrom(storage Storage, position uint64) ([]*StoredEvent, error) {
+	if positionReader, ok := storage.(PositionReader); ok {
+		return positionReader.ReadAllFrom(position)
+	}
+	events, err := storage.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if position >= uint64(len(events)) {
+		return make([]*StoredEvent, 0), nil
+	}
+	return events[position:], nil
+}
+
+// RangeReader is implemented by storages that can read count events from a
+// global position without reading the others, and tell how many events they
+// hold.
+type RangeReader interface {
+	ReadRange(position uint64, count int) ([]*StoredEvent, error)
+	EventCount() (uint64, error)
+}
+
+// ReadRange reads up to count events of storage from position on, through
+// RangeReader when the storage implements it.
+func ReadRange(storage Storage, position uint64, count int) ([]*StoredEvent, error) {
+	if rangeReader, ok := storage.(RangeReader); ok {
+		return rangeReader.ReadRange(position, count)
+	}
+	events, err := ReadAllFrom(storage, position)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > count {
+		events = events[:count]
+	}
+	return events, nil
+}
+
+// EventCount is the number of events of storage, the position the next one
+// will be written at.
+func EventCount(storage Storage) (uint64, error) {
+	if rangeReader, ok := storage.(RangeReader); ok {
+		return rangeReader.EventCount()
+	}
+	events, err := storage.ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(events)), nil
+}
+
+func (me *InMemoryStorage) ReadAllFrom(position uint64) ([]*StoredEvent, error) {
+	me.lock.RLock()
+	defer me.lock.RUnlock()
+
+	results := make([]*StoredEvent, 0)
+	for i := position; i < uint64(len(me.events)); i++ {
+		results = append(results, copyStoredEvent(me.events[i]))
+	}
+	return results, nil
+}
+
+func (me *InMemoryStorage) ReadRange(position uint64, count int) ([]*StoredEvent, error) {
+	me.lock.RLock()
+	defer me.lock.RUnlock()
+
+	results := make([]*StoredEvent, 0)
+	for i := position; i < uint64(len(me.events)) && len(results) < count; i++ {
+		results = append(results, copyStoredEvent(me.events[i]))
+	}
+	return results, nil
+}
+
+func (me *InMemoryStorage) EventCount() (uint64, error) {
+	me.lock.RLock()
+	defer me.lock.RUnlock()
+
+	return uint64(len(me.events)), nil
+}
+
+// globalOffset is the offset of an entry in the global index.
+type globalOffset struct {
+	position uint64
+	offset   int64
+}
+
+// ReadAllFrom reads the events from position up to the last complete batch.
+// Subscribers mostly read from where their previous read ended, so the offset
+// the latest read ended at is kept to seek there instead of reading the global
+// index from its start.
+func (me *DailyDiskStorage) ReadAllFrom(position uint64) ([]*StoredEvent, error) {
+	end, _ := me.EventCount()
+	return me.readRange(position, end)
+}
+
+// ReadRange reads up to count events from position, stopping at the last
+// complete batch.
+func (me *DailyDiskStorage) ReadRange(position uint64, count int) ([]*StoredEvent, error) {
+	end, _ := me.EventCount()
+	if position+uint64(count) < end {
+		end = position + uint64(count)
+	}
+	return me.readRange(position, end)
+}
+
+// EventCount is the position after the last complete batch.
+func (me *DailyDiskStorage) EventCount() (uint64, error) {
+	me.writeLock.Lock()
+	defer me.writeLock.Unlock()
+	return me.nextPosition, nil
+}
+
+// readRange reads the events from position up to end, excluded.
+func (me *DailyDiskStorage) readRange(position uint64, end uint64) ([]*StoredEvent, error) {
+	events := make([]*StoredEvent, 0)
+	if position >= end {
+		return events, nil
+	}
+
+	indexFile, err := os.OpenFile(me.globalIndexFilename, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer indexFile.Close()
+
+	me.tailLock.Lock()
+	tail := me.tail
+	me.tailLock.Unlock()
+	current := uint64(0)
+	if tail.position <= position {
+		if _, err = indexFile.Seek(tail.offset, os.SEEK_SET); err != nil {
+			return nil, err
+		}
+		current = tail.position
+	}
+
+	for ; current < end; current++ {
+		indexEntry, err := readIndexNextEntry(indexFile, me.format)
+		if err != nil {
+			return nil, err
+		}
+		if current < position {
+			continue
+		}
+		event, err := me.readStoredEvent(indexEntry)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	offset, err := indexFile.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return nil, err
+	}
+	me.tailLock.Lock()
+	if end > me.tail.position {
+		me.tail = globalOffset{end, offset}
+	}
+	me.tailLock.Unlock()
+	return events, nil
+}
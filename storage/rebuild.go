@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// forEachEventFile calls fn with the name of every file of the YYYYMM/DD tree.
+func (me *DailyDiskStorage) forEachEventFile(fn func(filename string) error) error {
+	months, err := ioutil.ReadDir(me.storagePath)
+	if err != nil {
+		return err
+	}
+	for _, month := range months {
+		if !month.IsDir() || len(month.Name()) != 6 {
+			continue
+		}
+		if _, err := strconv.Atoi(month.Name()); err != nil {
+			continue
+		}
+		monthPath := path.Join(me.storagePath, month.Name())
+		days, err := ioutil.ReadDir(monthPath)
+		if err != nil {
+			return err
+		}
+		for _, day := range days {
+			dayPath := path.Join(monthPath, day.Name())
+			events, err := ioutil.ReadDir(dayPath)
+			if err != nil {
+				return err
+			}
+			for _, event := range events {
+				if err = fn(path.Join(dayPath, event.Name())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type entriesByPosition []*IndexEntry
+
+func (me entriesByPosition) Len() int           { return len(me) }
+func (me entriesByPosition) Less(i, j int) bool { return me[i].position < me[j].position }
+func (me entriesByPosition) Swap(i, j int)      { me[i], me[j] = me[j], me[i] }
+
+// RebuildDailyDiskIndexes regenerates the global, stream and type indexes of
+// the DailyDiskStorage at storagePath from the index entries its event files
+// start with. The server must be stopped. The indexes are written next to the
+// current ones, which are then kept as indexes.before-rebuild.
+func RebuildDailyDiskIndexes(storagePath string) error {
+	storage := newDailyDiskStorage(storagePath)
+	format, err := readStoredFormat(storage)
+	if err != nil {
+		return err
+	}
+	if format < 5 {
+		return errors.New(fmt.Sprintf("Event files of format %v don't hold their index entry, indexes can only be rebuilt from format 5.", format))
+	}
+	storage.format = format
+
+	backupPath := storage.indexesPath + ".before-rebuild"
+	if _, err := os.Stat(backupPath); err == nil {
+		return errors.New(fmt.Sprintf("Backup path %s already exists.", backupPath))
+	}
+
+	fmt.Print("Reading event files... ")
+	entries := make([]*IndexEntry, 0)
+	err = storage.forEachEventFile(func(filename string) error {
+		entry, _, _, _, err := readEvent(filename, format)
+		if err != nil {
+			return errors.New(fmt.Sprintf("%s: %v", filename, err))
+		}
+		if storage.getEventFilename(entry) != filename {
+			return errors.New(fmt.Sprintf("%s: event file starts with the entry of %s", filename, storage.getEventFilename(entry)))
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Sort(entriesByPosition(entries))
+	for i, entry := range entries {
+		if entry.position != uint64(i) {
+			return errors.New(fmt.Sprintf("No event file holds position %v, found position %v next.", i, entry.position))
+		}
+	}
+	fmt.Println("Done.", len(entries), "events found.")
+
+	fmt.Print("Rebuilding indexes... ")
+	target := newDailyDiskStorage(storagePath)
+	target.format = format
+	target.setIndexesPath(storage.indexesPath + ".rebuilding")
+	if err := os.RemoveAll(target.indexesPath); err != nil {
+		return err
+	}
+	if err := target.writeIndexes(entries); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(storage.indexesPath); err == nil {
+		if err = os.Rename(storage.indexesPath, backupPath); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(target.indexesPath, storage.indexesPath); err != nil {
+		return err
+	}
+	if err := syncDir(storagePath); err != nil {
+		return err
+	}
+	fmt.Println("Done.")
+	fmt.Println("Previous indexes kept in", backupPath)
+
+	return nil
+}
+
+// writeIndexes writes and flushes the global, stream and type indexes of
+// entries, which are in global order.
+func (me *DailyDiskStorage) writeIndexes(entries []*IndexEntry) error {
+	if err := os.MkdirAll(me.typesIndexesPath, 0777); err != nil {
+		return err
+	}
+
+	streams := make(map[uuid.UUID][]*IndexEntry)
+	types := make(map[string][]*IndexEntry)
+	for _, entry := range entries {
+		streams[entry.streamId] = append(streams[entry.streamId], entry)
+		types[entry.typeId] = append(types[entry.typeId], entry)
+	}
+
+	if err := writeIndexFile(me.globalIndexFilename, entries, writeIndexEntry); err != nil {
+		return err
+	}
+	for streamId, streamEntries := range streams {
+		if err := writeIndexFile(me.getStreamIndexFilename(streamId), streamEntries, writeIndexEntry); err != nil {
+			return err
+		}
+	}
+	for typeId, typeEntries := range types {
+		if err := writeIndexFile(me.getTypeIndexFilename(typeId), typeEntries, me.writeTypeIndexEntry); err != nil {
+			return err
+		}
+	}
+	return syncDirs(map[string]bool{me.indexesPath: true, me.typesIndexesPath: true})
+}
+
+func writeIndexFile(filename string, entries []*IndexEntry, writeEntry func(*os.File, *IndexEntry) error) error {
+	indexFile, err := os.OpenFile(filename, os.O_EXCL|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer indexFile.Close()
+
+	for _, entry := range entries {
+		if err = writeEntry(indexFile, entry); err != nil {
+			return err
+		}
+	}
+	return indexFile.Sync()
+}
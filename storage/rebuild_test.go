@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"bytes"
+	"github.com/satori/go.uuid"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRebuildIndexesFromEventFiles(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewDailyDiskStorage(storagePath)
+	streams := []uuid.UUID{uuid.NewV4(), uuid.NewV4()}
+	for i := 0; i < 6; i++ {
+		storage.Write(&StoredEvent{streams[i%2], time.Now().Round(0), []string{"aType", "anotherType"}[i%2], []byte("{}"), "Metadata", []byte("{}")})
+	}
+	written, _ := storage.ReadAll()
+	os.RemoveAll(path.Join(storagePath, "indexes"))
+
+	//Act
+	err := RebuildDailyDiskIndexes(storagePath)
+
+	//Assert
+	if err != nil {
+		t.Fatalf("RebuildDailyDiskIndexes failed. Error: %v", err)
+	}
+	rebuilt := NewDailyDiskStorage(storagePath)
+	if events, err := rebuilt.ReadAll(); err != nil || !reflect.DeepEqual(events, written) {
+		t.Errorf("ReadAll failed. Got %+v and error %v, expected %+v", events, err, written)
+	}
+	if ver, _ := rebuilt.StreamVersion(streams[1]); ver != 3 {
+		t.Errorf("StreamVersion failed. Got %v, expected %v", ver, 3)
+	}
+	if problems, err := VerifyDailyDiskStorage(storagePath, new(bytes.Buffer)); err != nil || problems != 0 {
+		t.Errorf("Verify failed. Got %v problems and error %v", problems, err)
+	}
+	if err := rebuilt.Write(&StoredEvent{streams[0], time.Now(), "aType", []byte("{}"), "Metadata", []byte("{}")}); err != nil {
+		t.Errorf("Write failed. Error: %v", err)
+	}
+}
+
+func TestRebuildIndexesFailsOnMissingEventFile(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewDailyDiskStorage(storagePath).(*DailyDiskStorage)
+	streamId := uuid.NewV4()
+	event := &StoredEvent{streamId, time.Now(), "aType", []byte("{}"), "Metadata", []byte("{}")}
+	storage.Write(event)
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("{}"), "Metadata", []byte("{}")})
+	os.Remove(storage.getEventFilename(&IndexEntry{streamId, 0, event.CreationTime, event.TypeId}))
+
+	//Act
+	err := RebuildDailyDiskIndexes(storagePath)
+
+	//Assert
+	if err == nil || !strings.Contains(err.Error(), "position 0") {
+		t.Errorf("RebuildDailyDiskIndexes failed. Got error %v, expected missing position 0.", err)
+	}
+	if _, err := os.Stat(storage.globalIndexFilename); err != nil {
+		t.Errorf("RebuildDailyDiskIndexes failed. Expected indexes to be left in place: %v", err)
+	}
+}
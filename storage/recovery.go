@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Trailing bytes of an index up to this size that don't make up an entry are
+// considered left by an interrupted write; beyond it the index is corrupted.
+const MAX_TORN_ENTRY_SIZE = 64 * 1024
+
+// recover brings a DailyDiskStorage back to a consistent state after a crash
+// or a failed write: incomplete trailing index entries are truncated, and the
+// batch left in the journal is either completed, for the events that made it
+// to the global index, or rolled back.
+func (me *DailyDiskStorage) recover() error {
+	count := uint64(0)
+	err := me.recoverIndex(me.globalIndexFilename, func(*IndexEntry) {
+		count++
+	})
+	if err != nil {
+		return err
+	}
+	me.nextPosition = count
+
+	return me.recoverJournal()
+}
+
+func (me *DailyDiskStorage) report(format string, args ...interface{}) {
+	fmt.Printf("Recovery: "+format+"\n", args...)
+}
+
+// recoverIndex reads every entry of an index, truncating an incomplete
+// trailing entry. An entry that fails its checksum is only considered torn
+// when it is the last one.
+func (me *DailyDiskStorage) recoverIndex(filename string, fn func(*IndexEntry)) error {
+	indexFile, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer indexFile.Close()
+
+	stat, err := indexFile.Stat()
+	if err != nil {
+		return err
+	}
+	offset := int64(0)
+	for offset < stat.Size() {
+		entry, err := readIndexNextEntry(indexFile, me.format)
+		if err != nil {
+			if IsCorruption(err) {
+				if next, seekErr := indexFile.Seek(0, os.SEEK_CUR); seekErr != nil || next < stat.Size() {
+					return err
+				}
+			}
+			if stat.Size()-offset > MAX_TORN_ENTRY_SIZE {
+				return &CorruptionError{filename, offset, fmt.Sprintf("Unreadable entry (%v)", err)}
+			}
+			me.report("truncated an incomplete entry of %v bytes at the end of %s", stat.Size()-offset, filename)
+			if err = indexFile.Truncate(offset); err != nil {
+				return err
+			}
+			return indexFile.Sync()
+		}
+		fn(entry)
+		if offset, err = indexFile.Seek(0, os.SEEK_CUR); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (me *DailyDiskStorage) writeJournal(entries []*IndexEntry, sync bool) error {
+	journal, err := os.OpenFile(me.journalFilename, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	for _, entry := range entries {
+		if err = writeIndexEntry(journal, entry); err != nil {
+			return err
+		}
+	}
+	if sync {
+		return journal.Sync()
+	}
+	return nil
+}
+
+func (me *DailyDiskStorage) recoverJournal() error {
+	entries := make([]*IndexEntry, 0)
+	err := me.recoverIndex(me.journalFilename, func(entry *IndexEntry) {
+		entries = append(entries, entry)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.position >= me.nextPosition {
+			eventFilename := me.getEventFilename(entry)
+			err := os.Remove(eventFilename)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err == nil {
+				me.report("removed orphaned event file %s, its write was interrupted before it was indexed", eventFilename)
+			}
+			continue
+		}
+		if err := me.recoverStreamIndex(entry); err != nil {
+			return err
+		}
+		if err := me.recoverTypeIndex(entry); err != nil {
+			return err
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+	return os.Truncate(me.journalFilename, 0)
+}
+
+func (me *DailyDiskStorage) recoverStreamIndex(entry *IndexEntry) error {
+	filename := me.getStreamIndexFilename(entry.streamId)
+	found := false
+	err := me.recoverIndex(filename, func(indexed *IndexEntry) {
+		found = found || indexed.position == entry.position
+	})
+	if err != nil || found {
+		return err
+	}
+
+	me.report("appended missing entry for position %v to %s", entry.position, filename)
+	indexFiles := newAppendFiles()
+	defer indexFiles.close()
+	indexFile, err := indexFiles.open(filename)
+	if err != nil {
+		return err
+	}
+	if err = writeIndexEntry(indexFile, entry); err != nil {
+		return err
+	}
+	return indexFiles.sync()
+}
+
+func (me *DailyDiskStorage) recoverTypeIndex(entry *IndexEntry) error {
+	filename := me.getTypeIndexFilename(entry.typeId)
+	content, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(content) > 0 && !bytes.HasSuffix(content, CRLF) {
+		complete := 0
+		if last := bytes.LastIndex(content, CRLF); last != -1 {
+			complete = last + len(CRLF)
+		}
+		me.report("truncated an incomplete line of %v bytes at the end of %s", len(content)-complete, filename)
+		if err = os.Truncate(filename, int64(complete)); err != nil {
+			return err
+		}
+		content = content[:complete]
+	}
+
+	line := []byte(me.getEventFilename(entry)[len(me.storagePath)+1:])
+	line = append(line, CRLF...)
+	if bytes.HasPrefix(content, line) || bytes.Contains(content, append(append([]byte{}, CRLF...), line...)) {
+		return nil
+	}
+
+	me.report("appended missing entry for position %v to %s", entry.position, filename)
+	indexFiles := newAppendFiles()
+	defer indexFiles.close()
+	indexFile, err := indexFiles.open(filename)
+	if err != nil {
+		return err
+	}
+	if err = me.writeTypeIndexEntry(indexFile, entry); err != nil {
+		return err
+	}
+	return indexFiles.sync()
+}
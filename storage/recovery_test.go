@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func newRecoveryTestStorage() (*DailyDiskStorage, string) {
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	return NewDailyDiskStorage(storagePath).(*DailyDiskStorage), storagePath
+}
+
+func appendBytes(t *testing.T, filename string, content []byte) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.Write(content)
+}
+
+func assertStreamLength(t *testing.T, storage Storage, streamId uuid.UUID, expected int) {
+	events, err := storage.ReadStream(streamId)
+	if err != nil {
+		t.Fatalf("ReadStream failed. Error: %v", err)
+	}
+	if len(events) != expected {
+		t.Errorf("ReadStream failed. Got %v stored events, expected %v", len(events), expected)
+	}
+}
+
+func TestRecoveryTruncatesTornIndexEntry(t *testing.T) {
+	//Arrange
+	storage, storagePath := newRecoveryTestStorage()
+	defer os.RemoveAll(storagePath)
+	streamId := uuid.NewV4()
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("1stEvent"), "", nil})
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("2ndEvent"), "", nil})
+	torn := &StoredEvent{streamId, time.Now(), "aType", []byte("torn"), "", nil}
+	entry := &IndexEntry{streamId, storage.nextPosition, torn.CreationTime, torn.TypeId}
+	storage.writeJournal([]*IndexEntry{entry}, false)
+	writeEvent(storage.getEventFilename(entry), entry, torn, false)
+	appendBytes(t, storage.globalIndexFilename, streamId.Bytes()[:10])
+
+	//Act
+	recovered := NewDailyDiskStorage(storagePath)
+	err := recovered.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("3rdEvent"), "", nil})
+
+	//Assert
+	if err != nil {
+		t.Fatalf("Write failed. Error: %v", err)
+	}
+	if events, err := recovered.ReadAll(); err != nil || len(events) != 3 {
+		t.Errorf("ReadAll failed. Got %v stored events and error %v, expected %v", len(events), err, 3)
+	}
+	assertStreamLength(t, recovered, streamId, 3)
+}
+
+func TestRecoveryRemovesOrphanedEventFiles(t *testing.T) {
+	//Arrange
+	storage, storagePath := newRecoveryTestStorage()
+	defer os.RemoveAll(storagePath)
+	streamId := uuid.NewV4()
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("1stEvent"), "", nil})
+
+	orphan := &StoredEvent{streamId, time.Now(), "aType", []byte("orphan"), "", nil}
+	entry := &IndexEntry{streamId, storage.nextPosition, orphan.CreationTime, orphan.TypeId}
+	storage.writeJournal([]*IndexEntry{entry}, false)
+	os.MkdirAll(path.Dir(storage.getEventFilename(entry)), 0777)
+	writeEvent(storage.getEventFilename(entry), entry, orphan, false)
+
+	//Act
+	recovered := NewDailyDiskStorage(storagePath)
+
+	//Assert
+	if _, err := os.Stat(storage.getEventFilename(entry)); !os.IsNotExist(err) {
+		t.Errorf("Recovery failed. Orphaned event file %s still exists.", storage.getEventFilename(entry))
+	}
+	if content, _ := ioutil.ReadFile(storage.journalFilename); len(content) != 0 {
+		t.Error("Recovery failed. Journal wasn't cleared.")
+	}
+	assertStreamLength(t, recovered, streamId, 1)
+	if err := recovered.Write(orphan); err != nil {
+		t.Errorf("Write failed. Error: %v", err)
+	}
+}
+
+func TestRecoveryCompletesIndexesOfInterruptedBatch(t *testing.T) {
+	//Arrange
+	storage, storagePath := newRecoveryTestStorage()
+	defer os.RemoveAll(storagePath)
+	streamId := uuid.NewV4()
+	storage.Write(&StoredEvent{streamId, time.Now(), "aType", []byte("1stEvent"), "", nil})
+	streamIndex, _ := ioutil.ReadFile(storage.getStreamIndexFilename(streamId))
+	typeIndex, _ := ioutil.ReadFile(storage.getTypeIndexFilename("aType"))
+
+	event := &StoredEvent{streamId, time.Now(), "aType", []byte("2ndEvent"), "", nil}
+	entry := &IndexEntry{streamId, storage.nextPosition, event.CreationTime, event.TypeId}
+	storage.Write(event)
+	storage.writeJournal([]*IndexEntry{entry}, false)
+	ioutil.WriteFile(storage.getStreamIndexFilename(streamId), streamIndex, 0644)
+	ioutil.WriteFile(storage.getTypeIndexFilename("aType"), append(typeIndex, "2016"...), 0644)
+
+	//Act
+	recovered := NewDailyDiskStorage(storagePath)
+
+	//Assert
+	assertStreamLength(t, recovered, streamId, 2)
+	expectedTypeIndex := string(typeIndex) + storage.getEventFilename(entry)[len(storagePath)+1:] + "\r\n"
+	if content, _ := ioutil.ReadFile(storage.getTypeIndexFilename("aType")); string(content) != expectedTypeIndex {
+		t.Errorf("Recovery failed. Type index is %q, expected %q", content, expectedTypeIndex)
+	}
+}
@@ -8,22 +8,46 @@ import (
 	"path"
 	"fmt"
 	"errors"
+	"sync"
 )
 
+// On-disk format of a SimpleDiskStorage. Format 1 records hold the creation
+// time, type and data of an event; format 2 adds its metadata type and
+// metadata, and ends every record of the stream files and every index entry
+// with a CRC32C checksum.
+const SIMPLEDISK_FORMAT = 2
+const simpleIndexEntrySize = 16 + IntegerSizeInBytes
+
 func NewSimpleDiskStorage(storagePath string) Storage {
-	return &SimpleDiskStorage{storagePath, path.Join(storagePath, "eventindex")}
+	indexPath := path.Join(storagePath, "eventindex")
+	if err := os.MkdirAll(storagePath, 0777); err != nil {
+		panic(err)
+	}
+	format, err := readFormat(storagePath, indexPath, SIMPLEDISK_FORMAT)
+	if err != nil {
+		panic(err)
+	}
+	if format > SIMPLEDISK_FORMAT {
+		panic(fmt.Sprintf("Unsupported storage format %v, this version supports up to %v.", format, SIMPLEDISK_FORMAT))
+	}
+	return &SimpleDiskStorage{storagePath: storagePath, indexPath: indexPath, format: format}
 }
 
+// SimpleDiskStorage keeps writing a store in the format it was created in, so
+// stores created before checksums were added are read and written without them.
 type SimpleDiskStorage struct {
 	storagePath string
 	indexPath string
+	format int
+	durability Durability
+	writeLock sync.Mutex
 }
 
-func (me SimpleDiskStorage) getFilename(stream, extension string) string {
+func (me *SimpleDiskStorage) getFilename(stream, extension string) string {
 	return fmt.Sprintf("%v%v", path.Join(me.storagePath, stream[0:2], stream[2:]), extension)
 }
 
-func (me SimpleDiskStorage) GetFilenameForEvents(stream string) string {
+func (me *SimpleDiskStorage) GetFilenameForEvents(stream string) string {
 	return me.getFilename(stream, ".history")
 }
 
@@ -73,57 +97,157 @@ func readSizedBytes(f *os.File) ([]byte, error) {
 	return data, nil
 }
 
-func (me SimpleDiskStorage) Write(event *StoredEvent) error {
-	filename := me.GetFilenameForEvents(event.StreamId.String())
-	os.MkdirAll(path.Dir(filename), os.ModeDir)
+func (me *SimpleDiskStorage) SetDurability(durability Durability) {
+	me.durability = durability
+}
 
-	indexFile, err := os.OpenFile(me.indexPath, os.O_APPEND | os.O_WRONLY | os.O_CREATE, 0644)
-	if err != nil {
-		return err
+func (me *SimpleDiskStorage) Write(event *StoredEvent) error {
+	return me.WriteBatch([]*StoredEvent{event})
+}
+
+func (me *SimpleDiskStorage) WriteBatch(events []*StoredEvent) error {
+	me.writeLock.Lock()
+	defer me.writeLock.Unlock()
+
+	if me.durability == DURABILITY_FSYNC {
+		for i, event := range events {
+			if err := me.writeBatch([]*StoredEvent{event}); err != nil {
+				return batchError(i, err)
+			}
+		}
+		return nil
 	}
-	defer indexFile.Close()
+	return me.writeBatch(events)
+}
 
-	eventsFile, err := os.OpenFile(filename, os.O_APPEND | os.O_WRONLY | os.O_CREATE, 0644)
-	if err != nil {
-		return err
+// writeBatch appends the events to their stream files, then to the index.
+// Unless durability is none, the index is only written once the stream files
+// are flushed. A failed batch is rolled back.
+func (me *SimpleDiskStorage) writeBatch(events []*StoredEvent) (err error) {
+	sync := me.durability != DURABILITY_NONE
+
+	eventsFiles := newAppendFiles()
+	defer eventsFiles.close()
+	indexFiles := newAppendFiles()
+	defer indexFiles.close()
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, files := range []*appendFiles{indexFiles, eventsFiles} {
+			if rollbackErr := files.rollback(); rollbackErr != nil {
+				fmt.Println("Rollback failed:", rollbackErr)
+			}
+		}
+	}()
+
+	entries := make([][]byte, len(events))
+	for i, event := range events {
+		filename := me.GetFilenameForEvents(event.StreamId.String())
+		if err := os.MkdirAll(path.Dir(filename), 0777); err != nil {
+			return err
+		}
+		eventsFile, err := eventsFiles.open(filename)
+		if err != nil {
+			return err
+		}
+
+		stat, err := eventsFile.Stat()
+		if err != nil {
+			return err
+		}
+		position := stat.Size()
+
+		creationTimeBytes, err := event.CreationTime.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		fields := [][]byte{creationTimeBytes, []byte(event.TypeId), event.Data}
+		if me.format >= 2 {
+			fields = append(fields, []byte(event.MetadataTypeId), event.Metadata)
+		} else if event.MetadataTypeId != "" || len(event.Metadata) > 0 {
+			return errors.New("Storage format 1 can't keep metadata, write the event without it.")
+		}
+		record := make([]byte, 0)
+		for _, field := range fields {
+			record = appendSizedBytes(record, field)
+		}
+		if me.format >= 2 {
+			record = appendChecksum(record)
+		}
+		written, err := eventsFile.Write(record)
+		if err != nil {
+			return err
+		}
+		if written != len(record) {
+			return errors.New(fmt.Sprintf("Write error. Expected to write %v bytes, wrote only %v.", len(record), written))
+		}
+
+		entries[i] = make([]byte, simpleIndexEntrySize)
+		copy(entries[i], event.StreamId.Bytes())
+		binary.BigEndian.PutUint64(entries[i][16:], uint64(position))
+		if me.format >= 2 {
+			entries[i] = appendChecksum(entries[i])
+		}
+	}
+	if sync {
+		if err := eventsFiles.sync(); err != nil {
+			return err
+		}
+		if err := syncDir(me.storagePath); err != nil {
+			return err
+		}
 	}
-	defer eventsFile.Close()
 
-	stat, err := eventsFile.Stat()
+	indexFile, err := indexFiles.open(me.indexPath)
 	if err != nil {
 		return err
 	}
-	position := stat.Size()
+	for _, entry := range entries {
+		written, err := indexFile.Write(entry)
+		if err != nil {
+			return err
+		}
+		if written != len(entry) {
+			return errors.New(fmt.Sprintf("Write error. Expected to write %v bytes, wrote only %v.", len(entry), written))
+		}
+	}
+	if sync {
+		return indexFiles.sync()
+	}
+	return nil
+}
 
-	creationTimeBytes, err := event.CreationTime.MarshalBinary()
+func (me *SimpleDiskStorage) StreamVersion(streamId uuid.UUID) (uint32, error) {
+	eventsFile, err := os.OpenFile(me.GetFilenameForEvents(streamId.String()), os.O_RDONLY, 0)
 	if err != nil {
-		return err
+		return EMPTY_STREAM, errors.New("NOT_FOUND: " + err.Error())
 	}
-	writeSizeAndBytes(eventsFile, creationTimeBytes)
-	writeSizeAndBytes(eventsFile, []byte(event.TypeId))
-	writeSizeAndBytes(eventsFile, event.Data)
-
-	indexFile.Write(event.StreamId.Bytes())
-	positionBytes := make([]byte, IntegerSizeInBytes)
-	binary.BigEndian.PutUint64(positionBytes, uint64(position))
-	indexFile.Write(positionBytes)
+	defer eventsFile.Close()
 
-	return nil
-}
+	ver := EMPTY_STREAM
+	for {
+		_, err := getStoredData(eventsFile, streamId, me.format)
+		if err != nil && err.Error() == "EOF" {
+			break
+		}
+		if err != nil {
+			return EMPTY_STREAM, err
+		}
+		ver++
+	}
 
-func (me SimpleDiskStorage) StreamVersion(streamId uuid.UUID) (uint32, error) {
-	//TODO
-	return EMPTY_STREAM, nil
+	return ver, nil
 }
 
-func (me SimpleDiskStorage) ReadStream(streamId uuid.UUID) ([]*StoredEvent, error) {
+func (me *SimpleDiskStorage) ReadStream(streamId uuid.UUID) ([]*StoredEvent, error) {
 	streamName := streamId.String()
 	offset := int64(0) //TODO snapshots
 	filename := me.GetFilenameForEvents(streamName)
 
 	eventsFile, err := os.OpenFile(filename, os.O_RDONLY, 0)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("NOT_FOUND: " + err.Error())
 	}
 	defer eventsFile.Close()
 
@@ -131,51 +255,50 @@ func (me SimpleDiskStorage) ReadStream(streamId uuid.UUID) ([]*StoredEvent, erro
 
 	results := make([]*StoredEvent, 0)
 	for {
-		creationTime, typeId, data, err := getStoredData(eventsFile)
+		event, err := getStoredData(eventsFile, streamId, me.format)
 		if err != nil && err.Error() == "EOF" {
 			break
 		}
 		if err != nil {
 			return nil, err
 		}
-
-		//TODO metadata
-		event := &StoredEvent{streamId, creationTime, typeId, data, "", nil}
 		results = append(results, event)
 	}
 	return results, nil
 }
 
-func (me SimpleDiskStorage) ReadAll() ([]*StoredEvent, error) {
+func (me *SimpleDiskStorage) ReadAll() ([]*StoredEvent, error) {
 	indexFile, err := os.OpenFile(me.indexPath, os.O_RDONLY, 0)
+	if os.IsNotExist(err) {
+		return make([]*StoredEvent, 0), nil
+	}
 	if err != nil {
 		return nil, err
 	}
 	defer indexFile.Close()
 
+	entrySize := simpleIndexEntrySize
+	if me.format >= 2 {
+		entrySize += checksumSize
+	}
 	results := make([]*StoredEvent, 0)
-	guidBytes := make([]byte, 16)
-	offsetBytes := make([]byte, IntegerSizeInBytes)
-	for {
-		read, err := indexFile.Read(guidBytes)
+	entry := make([]byte, entrySize)
+	for entryOffset := int64(0); ; entryOffset += int64(entrySize) {
+		read, err := indexFile.Read(entry)
 		if err != nil {
 			break
 		}
-		if read != 16 {
+		if read != entrySize {
 			return nil, errors.New("index integrity error")
 		}
-		read, err = indexFile.Read(offsetBytes)
-		if err != nil {
-			return nil, err
-		}
-		if read != IntegerSizeInBytes {
-			return nil, errors.New("index integrity error")
+		if me.format >= 2 && !validChecksum(entry[:simpleIndexEntrySize], entry[simpleIndexEntrySize:]) {
+			return nil, &CorruptionError{me.indexPath, entryOffset, "Checksum mismatch"}
 		}
-		aggregateId, err := uuid.FromBytes(guidBytes)
+		aggregateId, err := uuid.FromBytes(entry[:16])
 		if err != nil {
 			return nil, err
 		}
-		offset := binary.BigEndian.Uint64(offsetBytes)
+		offset := binary.BigEndian.Uint64(entry[16:simpleIndexEntrySize])
 
 		storedEvent, err := me.retrieveStoredEvent(aggregateId, int64(offset))
 		if err != nil {
@@ -187,7 +310,7 @@ func (me SimpleDiskStorage) ReadAll() ([]*StoredEvent, error) {
 	return results, nil
 }
 
-func (me SimpleDiskStorage) retrieveStoredEvent(streamId uuid.UUID, offset int64) (*StoredEvent, error) {
+func (me *SimpleDiskStorage) retrieveStoredEvent(streamId uuid.UUID, offset int64) (*StoredEvent, error) {
 	filename := me.GetFilenameForEvents(streamId.String())
 
 	eventsFile, err := os.OpenFile(filename, os.O_RDONLY, 0)
@@ -198,37 +321,53 @@ func (me SimpleDiskStorage) retrieveStoredEvent(streamId uuid.UUID, offset int64
 
 	eventsFile.Seek(offset, 0)
 
-	creationTime, typeId, data, err := getStoredData(eventsFile)
-	if err != nil {
-		return nil, err
-	}
-
-	//TODO metadata
-	event := &StoredEvent{streamId, creationTime, typeId, data, "", nil}
-	return event, nil
+	return getStoredData(eventsFile, streamId, me.format)
 }
 
-func getStoredData(eventsFile *os.File) (creationTime time.Time, typeId string, data []byte, err error) {
-	creationTimeBytes, err := readSizedBytes(eventsFile)
-	if err != nil {
-		return
+// getStoredData reads the record at the current offset of a stream file.
+// Events of format 1 records have no metadata.
+func getStoredData(eventsFile *os.File, streamId uuid.UUID, format int) (*StoredEvent, error) {
+	fields := make([][]byte, 5)
+	if format == 1 {
+		fields = fields[:3]
 	}
-	err = creationTime.UnmarshalBinary(creationTimeBytes)
-	if err != nil {
-		return
+	var err error
+	for i := range fields {
+		if fields[i], err = readSizedBytes(eventsFile); err != nil {
+			return nil, err
+		}
 	}
 
-	typeIdBytes, err := readSizedBytes(eventsFile)
-	if err != nil {
-		return
+	if format >= 2 {
+		record := make([]byte, 0)
+		for _, field := range fields {
+			record = appendSizedBytes(record, field)
+		}
+		checksum := make([]byte, checksumSize)
+		read, err := eventsFile.Read(checksum)
+		if err != nil && err.Error() != "EOF" {
+			return nil, err
+		}
+		if read != checksumSize || !validChecksum(record, checksum) {
+			offset, err := eventsFile.Seek(0, os.SEEK_CUR)
+			if err != nil {
+				return nil, err
+			}
+			return nil, &CorruptionError{eventsFile.Name(), offset - int64(len(record) + read), "Checksum mismatch"}
+		}
 	}
-	typeId = string(typeIdBytes)
 
-	data, err = readSizedBytes(eventsFile)
+	var creationTime time.Time
+	if err = creationTime.UnmarshalBinary(fields[0]); err != nil {
+		return nil, err
+	}
 
-	return
+	if format == 1 {
+		return &StoredEvent{streamId, creationTime, string(fields[1]), fields[2], "", nil}, nil
+	}
+	return &StoredEvent{streamId, creationTime, string(fields[1]), fields[2], string(fields[3]), fields[4]}, nil
 }
 
-func (me SimpleDiskStorage) RebuildTypeIndexes() {
-
+func (me *SimpleDiskStorage) RebuildTypeIndexes() error {
+	return nil
 }
\ No newline at end of file
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"encoding/binary"
+	"github.com/satori/go.uuid"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeFormat1SimpleEvent appends an event the way stores without a format
+// file were written: creation time, type and data, indexed without checksum.
+func writeFormat1SimpleEvent(t *testing.T, storagePath string, event *StoredEvent) {
+	stream := event.StreamId.String()
+	eventsFilename := path.Join(storagePath, stream[0:2], stream[2:]) + ".history"
+	os.MkdirAll(path.Dir(eventsFilename), 0777)
+	eventsFile, err := os.OpenFile(eventsFilename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eventsFile.Close()
+	stat, _ := eventsFile.Stat()
+	creationTimeBytes, _ := event.CreationTime.MarshalBinary()
+	writeSizeAndBytes(eventsFile, creationTimeBytes)
+	writeSizeAndBytes(eventsFile, []byte(event.TypeId))
+	writeSizeAndBytes(eventsFile, event.Data)
+
+	indexFile, err := os.OpenFile(path.Join(storagePath, "eventindex"), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexFile.Close()
+	positionBytes := make([]byte, IntegerSizeInBytes)
+	binary.BigEndian.PutUint64(positionBytes, uint64(stat.Size()))
+	indexFile.Write(event.StreamId.Bytes())
+	indexFile.Write(positionBytes)
+}
+
+func TestSimpleDiskReadsFormat1Storage(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	streamId1, streamId2 := uuid.NewV4(), uuid.NewV4()
+	ev1 := &StoredEvent{streamId1, time.Date(2016, 2, 11, 9, 53, 32, 1234567, time.UTC), "1stType", []byte("1stEvent"), "", nil}
+	ev2 := &StoredEvent{streamId2, time.Date(2016, 2, 12, 10, 0, 0, 0, time.UTC), "2ndType", []byte("2ndEvent"), "", nil}
+	ev3 := &StoredEvent{streamId1, time.Date(2016, 2, 13, 10, 0, 0, 0, time.UTC), "1stType", []byte("3rdEvent"), "", nil}
+	writeFormat1SimpleEvent(t, storagePath, ev1)
+	writeFormat1SimpleEvent(t, storagePath, ev2)
+
+	//Act
+	storage := NewSimpleDiskStorage(storagePath).(*SimpleDiskStorage)
+	writeErr := storage.Write(ev3)
+	metadataErr := storage.Write(&StoredEvent{streamId1, time.Now(), "1stType", []byte("4thEvent"), "Metadata", []byte("{}")})
+	streamEvents, streamErr := storage.ReadStream(streamId1)
+	allEvents, allErr := storage.ReadAll()
+	version, versionErr := storage.StreamVersion(streamId1)
+
+	//Assert
+	if storage.format != 1 {
+		t.Errorf("Storage is in format %v, expected 1", storage.format)
+	}
+	if writeErr != nil {
+		t.Errorf("Write failed. Error: %v", writeErr)
+	}
+	if metadataErr == nil {
+		t.Error("Write of an event with metadata succeeded on a format 1 storage, expected an error.")
+	}
+	if streamErr != nil || !reflect.DeepEqual(streamEvents, []*StoredEvent{ev1, ev3}) {
+		t.Errorf("ReadStream returned %+v, %v, expected %+v and %+v", streamEvents, streamErr, ev1, ev3)
+	}
+	if allErr != nil || !reflect.DeepEqual(allEvents, []*StoredEvent{ev1, ev2, ev3}) {
+		t.Errorf("ReadAll returned %+v, %v, expected %+v, %+v and %+v", allEvents, allErr, ev1, ev2, ev3)
+	}
+	if versionErr != nil || version != 2 {
+		t.Errorf("StreamVersion returned %v, %v, expected 2", version, versionErr)
+	}
+}
+
+func TestSimpleDiskRollsBackAFailedBatch(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	streamId := uuid.NewV4()
+	ev1 := &StoredEvent{streamId, time.Date(2016, 2, 11, 9, 53, 32, 1234567, time.UTC), "1stType", []byte("1stEvent"), "", nil}
+	writeFormat1SimpleEvent(t, storagePath, ev1)
+	storage := NewSimpleDiskStorage(storagePath).(*SimpleDiskStorage)
+	newStreamId := uuid.NewV4()
+
+	//Act
+	err := storage.WriteBatch([]*StoredEvent{
+		{streamId, time.Now(), "1stType", []byte("2ndEvent"), "", nil},
+		{newStreamId, time.Now(), "1stType", []byte("3rdEvent"), "", nil},
+		{streamId, time.Now(), "1stType", []byte("4thEvent"), "Metadata", []byte("{}")}})
+
+	//Assert
+	if err == nil {
+		t.Error("WriteBatch succeeded, expected an error.")
+	}
+	if events, err := storage.ReadAll(); err != nil || !reflect.DeepEqual(events, []*StoredEvent{ev1}) {
+		t.Errorf("ReadAll returned %+v, %v, expected only %+v", events, err, ev1)
+	}
+	if events, err := storage.ReadStream(streamId); err != nil || !reflect.DeepEqual(events, []*StoredEvent{ev1}) {
+		t.Errorf("ReadStream returned %+v, %v, expected only %+v", events, err, ev1)
+	}
+	if _, err := os.Stat(storage.GetFilenameForEvents(newStreamId.String())); !os.IsNotExist(err) {
+		t.Errorf("The events file of a new stream was kept after rollback. Error: %v", err)
+	}
+}
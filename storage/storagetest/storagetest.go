@@ -0,0 +1,338 @@
+// Package storagetest is the conformance suite every storage.Storage
+// implementation must pass.
+package storagetest
+
+import (
+	storage ".."
+	"bytes"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Factory creates a storage in an empty directory.
+type Factory func(storagePath string) storage.Storage
+
+// Run runs the conformance suite against the storages created by newStorage.
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		test func(*testing.T, storage.Storage)
+	}{
+		{"ReadStreamReturnsEventsInOrder", testReadStreamReturnsEventsInOrder},
+		{"ReadAllReturnsEventsInGlobalOrder", testReadAllReturnsEventsInGlobalOrder},
+		{"EventsRoundTrip", testEventsRoundTrip},
+		{"StreamVersionCountsEvents", testStreamVersionCountsEvents},
+		{"UnknownStreamIsNotFound", testUnknownStreamIsNotFound},
+		{"EmptyStorageReadsNothing", testEmptyStorageReadsNothing},
+		{"ConcurrentWrites", testConcurrentWrites},
+		{"WriteBatchWritesInOrder", testWriteBatchWritesInOrder},
+		{"ReadAllFromReadsFromPosition", testReadAllFromReadsFromPosition},
+		{"ReadRangeReadsCountEvents", testReadRangeReadsCountEvents},
+		{"WriteAfterCloseFails", testWriteAfterCloseFails},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+			defer os.RemoveAll(storagePath)
+			test.test(t, newStorage(storagePath))
+		})
+	}
+}
+
+func newEvent(streamId uuid.UUID, typeId string, data string) *storage.StoredEvent {
+	return &storage.StoredEvent{
+		StreamId:       streamId,
+		CreationTime:   time.Now(),
+		TypeId:         typeId,
+		Data:           []byte(data),
+		MetadataTypeId: "Metadata",
+		Metadata:       []byte(`{"source":"storagetest"}`),
+	}
+}
+
+func write(t *testing.T, store storage.Storage, events ...*storage.StoredEvent) {
+	for _, event := range events {
+		if err := store.Write(event); err != nil {
+			t.Fatalf("Write failed. Error: %v", err)
+		}
+	}
+}
+
+func sameEvent(a, b *storage.StoredEvent) bool {
+	return a.StreamId == b.StreamId &&
+		a.CreationTime.Equal(b.CreationTime) &&
+		a.TypeId == b.TypeId &&
+		bytes.Equal(a.Data, b.Data) &&
+		a.MetadataTypeId == b.MetadataTypeId &&
+		bytes.Equal(a.Metadata, b.Metadata)
+}
+
+func assertEvents(t *testing.T, operation string, actual []*storage.StoredEvent, expected ...*storage.StoredEvent) {
+	if len(actual) != len(expected) {
+		t.Fatalf("%s failed. Got %v stored events, expected %v", operation, len(actual), len(expected))
+	}
+	for i := range expected {
+		if !sameEvent(actual[i], expected[i]) {
+			t.Errorf("%s failed. Event %v doesn't match. %+v != %+v", operation, i, actual[i], expected[i])
+		}
+	}
+}
+
+func testReadStreamReturnsEventsInOrder(t *testing.T, store storage.Storage) {
+	streamId := uuid.NewV4()
+	ev1 := newEvent(streamId, "1stType", "1stEvent")
+	ev2 := newEvent(streamId, "2ndType", "2ndEvent")
+	ev3 := newEvent(streamId, "1stType", "3rdEvent")
+	write(t, store, ev1, ev2, ev3, newEvent(uuid.NewV4(), "1stType", "otherStream"))
+
+	events, err := store.ReadStream(streamId)
+	if err != nil {
+		t.Fatalf("ReadStream failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadStream", events, ev1, ev2, ev3)
+}
+
+func testReadAllReturnsEventsInGlobalOrder(t *testing.T, store storage.Storage) {
+	stream1Id := uuid.NewV4()
+	stream2Id := uuid.NewV4()
+	ev1 := newEvent(stream1Id, "1stType", "1stEvent")
+	ev2 := newEvent(stream2Id, "2ndType", "2ndEvent")
+	ev3 := newEvent(stream1Id, "3rdType", "3rdEvent")
+	write(t, store, ev1, ev2, ev3)
+
+	events, err := store.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadAll", events, ev1, ev2, ev3)
+}
+
+func testEventsRoundTrip(t *testing.T, store storage.Storage) {
+	streamId := uuid.NewV4()
+	creationTime := time.Date(2016, 2, 11, 9, 53, 32, 1234567, time.FixedZone("UTC-5", -5*60*60))
+	withSeparators := newEvent(streamId, "aType", "{\r\n  \"a\": 1\r\n}")
+	withSeparators.CreationTime = creationTime
+	withSeparators.Metadata = []byte("{\r\n}")
+	withoutMetadata := newEvent(streamId, "aType", "{}")
+	withoutMetadata.MetadataTypeId = ""
+	withoutMetadata.Metadata = []byte{}
+	binaryEvent := newEvent(streamId, "binaryType", "")
+	binaryEvent.Data = []byte{0, 1, 2, '\r', '\n', 255}
+	binaryEvent.MetadataTypeId = "binaryMetadata"
+	binaryEvent.Metadata = []byte{0, '\r', '\n'}
+	write(t, store, withSeparators, withoutMetadata, binaryEvent)
+
+	events, err := store.ReadStream(streamId)
+	if err != nil {
+		t.Fatalf("ReadStream failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadStream", events, withSeparators, withoutMetadata, binaryEvent)
+	events, err = store.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadAll", events, withSeparators, withoutMetadata, binaryEvent)
+}
+
+func testStreamVersionCountsEvents(t *testing.T, store storage.Storage) {
+	streamId := uuid.NewV4()
+	for i := uint32(1); i <= 3; i++ {
+		write(t, store, newEvent(streamId, "aType", fmt.Sprintf("Event %v", i)), newEvent(uuid.NewV4(), "aType", "otherStream"))
+		ver, err := store.StreamVersion(streamId)
+		if err != nil {
+			t.Fatalf("StreamVersion failed. Error: %v", err)
+		}
+		if ver != i {
+			t.Errorf("StreamVersion failed. Got %v, expected %v", ver, i)
+		}
+	}
+}
+
+func testUnknownStreamIsNotFound(t *testing.T, store storage.Storage) {
+	write(t, store, newEvent(uuid.NewV4(), "aType", "otherStream"))
+	streamId := uuid.NewV4()
+
+	ver, err := store.StreamVersion(streamId)
+	if err == nil || !strings.HasPrefix(err.Error(), "NOT_FOUND") {
+		t.Errorf("StreamVersion failed. Got error %v, expected NOT_FOUND.", err)
+	}
+	if ver != storage.EMPTY_STREAM {
+		t.Errorf("StreamVersion failed. Got %v, expected %v", ver, storage.EMPTY_STREAM)
+	}
+
+	_, err = store.ReadStream(streamId)
+	if err == nil || !strings.HasPrefix(err.Error(), "NOT_FOUND") {
+		t.Errorf("ReadStream failed. Got error %v, expected NOT_FOUND.", err)
+	}
+}
+
+func testEmptyStorageReadsNothing(t *testing.T, store storage.Storage) {
+	events, err := store.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed. Error: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("ReadAll failed. Got %v stored events, expected none", len(events))
+	}
+}
+
+func testConcurrentWrites(t *testing.T, store storage.Storage) {
+	writers := 8
+	eventsPerWriter := 25
+	streamIds := make([]uuid.UUID, writers)
+	errs := make(chan error, writers*eventsPerWriter)
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		streamIds[i] = uuid.NewV4()
+		wg.Add(1)
+		go func(writer int, streamId uuid.UUID) {
+			defer wg.Done()
+			for j := 0; j < eventsPerWriter; j++ {
+				event := newEvent(streamId, "sameType", fmt.Sprintf("%v-%v", writer, j))
+				event.CreationTime = time.Date(2016, 2, 11, 9, 53, 32, 1234567, time.UTC)
+				if err := store.Write(event); err != nil {
+					errs <- err
+				}
+			}
+		}(i, streamIds[i])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Write failed. Error: %v", err)
+	}
+
+	events, err := store.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed. Error: %v", err)
+	}
+	if len(events) != writers*eventsPerWriter {
+		t.Fatalf("ReadAll failed. Got %v stored events, expected %v", len(events), writers*eventsPerWriter)
+	}
+	for i, streamId := range streamIds {
+		events, err := store.ReadStream(streamId)
+		if err != nil {
+			t.Fatalf("ReadStream failed. Error: %v", err)
+		}
+		if len(events) != eventsPerWriter {
+			t.Fatalf("ReadStream failed. Got %v stored events, expected %v", len(events), eventsPerWriter)
+		}
+		for j, event := range events {
+			if expected := fmt.Sprintf("%v-%v", i, j); string(event.Data) != expected {
+				t.Errorf("ReadStream failed. Event %v is %s, expected %s", j, event.Data, expected)
+			}
+		}
+		if ver, _ := store.StreamVersion(streamId); ver != uint32(eventsPerWriter) {
+			t.Errorf("StreamVersion failed. Got %v, expected %v", ver, eventsPerWriter)
+		}
+	}
+}
+
+func testWriteBatchWritesInOrder(t *testing.T, store storage.Storage) {
+	batchWriter, ok := store.(storage.BatchWriter)
+	if !ok {
+		t.Skip("Storage doesn't implement WriteBatch.")
+	}
+	stream1Id := uuid.NewV4()
+	stream2Id := uuid.NewV4()
+	ev1 := newEvent(stream1Id, "1stType", "1stEvent")
+	ev2 := newEvent(stream2Id, "2ndType", "2ndEvent")
+	ev3 := newEvent(stream1Id, "1stType", "3rdEvent")
+	write(t, store, newEvent(stream2Id, "2ndType", "0thEvent"))
+
+	if err := batchWriter.WriteBatch([]*storage.StoredEvent{ev1, ev2, ev3}); err != nil {
+		t.Fatalf("WriteBatch failed. Error: %v", err)
+	}
+
+	events, err := store.ReadStream(stream1Id)
+	if err != nil {
+		t.Fatalf("ReadStream failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadStream", events, ev1, ev3)
+	events, err = store.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadAll", events[1:], ev1, ev2, ev3)
+	if ver, _ := store.StreamVersion(stream2Id); ver != 2 {
+		t.Errorf("StreamVersion failed. Got %v, expected %v", ver, 2)
+	}
+}
+
+func testReadAllFromReadsFromPosition(t *testing.T, store storage.Storage) {
+	ev1 := newEvent(uuid.NewV4(), "1stType", "1stEvent")
+	ev2 := newEvent(uuid.NewV4(), "2ndType", "2ndEvent")
+	ev3 := newEvent(uuid.NewV4(), "1stType", "3rdEvent")
+	write(t, store, ev1, ev2)
+
+	events, err := storage.ReadAllFrom(store, 1)
+	if err != nil {
+		t.Fatalf("ReadAllFrom failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadAllFrom", events, ev2)
+
+	write(t, store, ev3)
+	events, err = storage.ReadAllFrom(store, 2)
+	if err != nil {
+		t.Fatalf("ReadAllFrom failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadAllFrom", events, ev3)
+	events, err = storage.ReadAllFrom(store, 0)
+	if err != nil {
+		t.Fatalf("ReadAllFrom failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadAllFrom", events, ev1, ev2, ev3)
+	events, err = storage.ReadAllFrom(store, 3)
+	if err != nil {
+		t.Fatalf("ReadAllFrom failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadAllFrom", events)
+}
+
+func testReadRangeReadsCountEvents(t *testing.T, store storage.Storage) {
+	ev1 := newEvent(uuid.NewV4(), "1stType", "1stEvent")
+	ev2 := newEvent(uuid.NewV4(), "2ndType", "2ndEvent")
+	ev3 := newEvent(uuid.NewV4(), "1stType", "3rdEvent")
+	write(t, store, ev1, ev2, ev3)
+
+	events, err := storage.ReadRange(store, 1, 1)
+	if err != nil {
+		t.Fatalf("ReadRange failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadRange", events, ev2)
+	events, err = storage.ReadRange(store, 1, 5)
+	if err != nil {
+		t.Fatalf("ReadRange failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadRange", events, ev2, ev3)
+	events, err = storage.ReadRange(store, 3, 5)
+	if err != nil {
+		t.Fatalf("ReadRange failed. Error: %v", err)
+	}
+	assertEvents(t, "ReadRange", events)
+	if count, err := storage.EventCount(store); err != nil || count != 3 {
+		t.Errorf("EventCount failed. Got %v, %v, expected 3", count, err)
+	}
+}
+
+func testWriteAfterCloseFails(t *testing.T, store storage.Storage) {
+	if _, ok := store.(storage.Closer); !ok {
+		t.Skip("The storage holds nothing to close.")
+	}
+	if err := storage.Close(store); err != nil {
+		t.Fatalf("Close failed. Error: %v", err)
+	}
+
+	err := store.Write(newEvent(uuid.NewV4(), "1stType", "1stEvent"))
+	if err != storage.ErrClosed {
+		t.Errorf("Write after Close failed with %v, expected %v", err, storage.ErrClosed)
+	}
+}
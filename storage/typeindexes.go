@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+// A rebuild prints its progress every REBUILD_PROGRESS_INTERVAL events.
+const REBUILD_PROGRESS_INTERVAL = 100000
+
+func reportRebuildProgress(done uint64, total uint64) {
+	if done%REBUILD_PROGRESS_INTERVAL == 0 {
+		fmt.Printf("  %v/%v events\n", done, total)
+	}
+}
+
+// replaceDir puts the rebuilt directory in place of the live one, which is
+// removed. Callers hold the write lock, so no write sees the directory missing
+// between the two renames. A crash between them leaves the live directory
+// moved to live.old, recoverReplacedDir puts it back when the store is opened.
+func replaceDir(live string, rebuilt string) error {
+	old := live + ".old"
+	if err := os.RemoveAll(old); err != nil {
+		return err
+	}
+	if err := os.Rename(live, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(rebuilt, live); err != nil {
+		return err
+	}
+	if err := syncDir(path.Dir(live)); err != nil {
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// recoverReplacedDir completes or undoes a replaceDir interrupted by a crash.
+// Without the live directory, the previous one is moved back: it holds every
+// entry, the rebuilt one may not. Otherwise the previous one is removed.
+func recoverReplacedDir(live string) error {
+	old := live + ".old"
+	if _, err := os.Stat(old); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Stat(live); os.IsNotExist(err) {
+		fmt.Println("Recovery: restoring", live, "moved away by an interrupted rebuild")
+		if err := os.Rename(old, live); err != nil {
+			return err
+		}
+		return syncDir(path.Dir(live))
+	}
+	return os.RemoveAll(old)
+}
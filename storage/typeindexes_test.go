@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"github.com/satori/go.uuid"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeTypedEvents(t *testing.T, storage Storage, count int) {
+	streamId := uuid.NewV4()
+	for i := 0; i < count; i++ {
+		event := &StoredEvent{streamId, time.Now(), []string{"aType", "anotherType"}[i%2], []byte("{}"), "Metadata", []byte("{}")}
+		if err := storage.Write(event); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+}
+
+func rebuildTypeIndexesWhileWriting(t *testing.T, storage Storage) {
+	writeTypedEvents(t, storage, 50)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		writeTypedEvents(t, storage, 50)
+	}()
+	err := storage.RebuildTypeIndexes()
+	wg.Wait()
+
+	if err != nil {
+		t.Fatalf("RebuildTypeIndexes failed. Error: %v", err)
+	}
+}
+
+func TestDailyDiskRebuildTypeIndexesWithConcurrentWrites(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewDailyDiskStorage(storagePath).(*DailyDiskStorage)
+
+	//Act
+	rebuildTypeIndexesWhileWriting(t, storage)
+
+	//Assert
+	out := new(bytes.Buffer)
+	if problems, err := VerifyDailyDiskStorage(storagePath, out); err != nil || problems != 0 {
+		t.Errorf("RebuildTypeIndexes failed. Got %v problems and error %v. Report:\n%s", problems, err, out)
+	}
+	if _, err := os.Stat(storage.typesIndexesPath + ".rebuilding"); !os.IsNotExist(err) {
+		t.Errorf("RebuildTypeIndexes failed. Expected temporary directory to be gone, got %v", err)
+	}
+}
+
+func TestChunkRebuildTypeIndexesWithConcurrentWrites(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := newChunkDiskStorage(storagePath, CHUNK_SIZE)
+
+	//Act
+	rebuildTypeIndexesWhileWriting(t, storage)
+
+	//Assert
+	for _, typeId := range []string{"aType", "anotherType"} {
+		locations, err := readLocations(storage.getTypeIndexFilename(typeId))
+		if err != nil || len(locations) != 50 {
+			t.Errorf("RebuildTypeIndexes failed. Got %v locations for %s and error %v, expected %v", len(locations), typeId, err, 50)
+		}
+	}
+}
+
+func TestRebuildTypeIndexesReturnsErrors(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewDailyDiskStorage(storagePath).(*DailyDiskStorage)
+	writeTypedEvents(t, storage, 2)
+	flipByte(t, storage.globalIndexFilename, 20)
+
+	//Act
+	err := storage.RebuildTypeIndexes()
+
+	//Assert
+	if !IsCorruption(err) {
+		t.Errorf("RebuildTypeIndexes failed. Got error %v, expected a corruption.", err)
+	}
+	if _, err := os.Stat(storage.getTypeIndexFilename("aType")); err != nil {
+		t.Errorf("RebuildTypeIndexes failed. Expected type indexes to be left in place: %v", err)
+	}
+}
+
+func TestDailyDiskRecoversTypeIndexesMovedAwayByAnInterruptedRebuild(t *testing.T) {
+	//Arrange
+	storagePath := path.Join(os.TempDir(), uuid.NewV4().String())
+	defer os.RemoveAll(storagePath)
+	storage := NewDailyDiskStorage(storagePath).(*DailyDiskStorage)
+	writeTypedEvents(t, storage, 4)
+	if err := os.Rename(storage.typesIndexesPath, storage.typesIndexesPath+".old"); err != nil {
+		t.Fatal(err)
+	}
+
+	//Act
+	reopened := NewDailyDiskStorage(storagePath).(*DailyDiskStorage)
+
+	//Assert
+	if _, err := os.Stat(reopened.typesIndexesPath + ".old"); !os.IsNotExist(err) {
+		t.Errorf("Open failed. Expected the moved directory to be gone, got %v", err)
+	}
+	out := new(bytes.Buffer)
+	if problems, err := VerifyDailyDiskStorage(storagePath, out); err != nil || problems != 0 {
+		t.Errorf("Open failed. Got %v problems and error %v. Report:\n%s", problems, err, out)
+	}
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type verifier struct {
+	storage  *DailyDiskStorage
+	out      io.Writer
+	problems int
+}
+
+func (me *verifier) problem(format string, args ...interface{}) {
+	me.problems++
+	fmt.Fprintf(me.out, "Problem: "+format+"\n", args...)
+}
+
+// VerifyDailyDiskStorage checks the DailyDiskStorage at storagePath without
+// modifying it: every entry of the global, stream and type indexes must
+// reference an event file that exists and parses, and the stream and type
+// indexes must hold the same events in the same order as the global index.
+// Problems are printed to out as they are found and counted in the result; an
+// error means the store couldn't be verified at all.
+func VerifyDailyDiskStorage(storagePath string, out io.Writer) (int, error) {
+	storage := newDailyDiskStorage(storagePath)
+	format, err := readStoredFormat(storage)
+	if err != nil {
+		return 0, err
+	}
+	storage.format = format
+	verifier := &verifier{storage: storage, out: out}
+
+	fmt.Fprintf(out, "Verifying DailyDiskStorage %s, format %v.\n", storagePath, format)
+	if stat, err := os.Stat(storage.journalFilename); err == nil && stat.Size() > 0 {
+		verifier.problem("%s isn't empty, a write was interrupted and the store must be opened once to recover", storage.journalFilename)
+	}
+
+	streams, types, referenced, events := verifier.verifyGlobalIndex()
+	streamCount, err := verifier.verifyStreamIndexes(streams)
+	if err != nil {
+		return verifier.problems, err
+	}
+	typeCount, err := verifier.verifyTypeIndexes(types)
+	if err != nil {
+		return verifier.problems, err
+	}
+	if err := verifier.verifyEventFiles(referenced); err != nil {
+		return verifier.problems, err
+	}
+
+	fmt.Fprintf(out, "Verified %v events, %v streams and %v types: %v problems.\n", events, streamCount, typeCount, verifier.problems)
+	return verifier.problems, nil
+}
+
+func readStoredFormat(storage *DailyDiskStorage) (int, error) {
+	content, err := ioutil.ReadFile(path.Join(storage.storagePath, formatFilename))
+	if err == nil {
+		return strconv.Atoi(strings.TrimSpace(string(content)))
+	}
+	if !os.IsNotExist(err) {
+		return 0, err
+	}
+	if _, err := os.Stat(storage.globalIndexFilename); err != nil {
+		return 0, errors.New(fmt.Sprintf("%s isn't a DailyDiskStorage: %v", storage.storagePath, err))
+	}
+	return 1, nil
+}
+
+// verifyGlobalIndex reads the global index and checks its event files. It
+// returns the event filenames of each stream and the relative ones of each
+// type in global order, the set of referenced filenames and the event count.
+func (me *verifier) verifyGlobalIndex() (map[uuid.UUID][]string, map[string][]string, map[string]bool, uint64) {
+	streams := make(map[uuid.UUID][]string)
+	types := make(map[string][]string)
+	referenced := make(map[string]bool)
+	count := uint64(0)
+
+	me.forEachEntry(me.storage.globalIndexFilename, func(entry *IndexEntry) {
+		if me.storage.format > 1 && entry.position != count {
+			me.problem("%s: entry %v has position %v", me.storage.globalIndexFilename, count, entry.position)
+		}
+		count++
+
+		filename := me.storage.getEventFilename(entry)
+		streams[entry.streamId] = append(streams[entry.streamId], filename)
+		types[entry.typeId] = append(types[entry.typeId], filename[len(me.storage.storagePath)+1:])
+		if referenced[filename] {
+			return
+		}
+		referenced[filename] = true
+		header, _, _, _, err := readEvent(filename, me.storage.format)
+		if err != nil {
+			me.problem("%s: event at position %v of stream %v: %v", me.storage.globalIndexFilename, entry.position, entry.streamId, err)
+			return
+		}
+		if header != nil && (header.streamId != entry.streamId || header.position != entry.position) {
+			me.problem("%s: event at position %v of stream %v starts with position %v of stream %v", me.storage.globalIndexFilename, entry.position, entry.streamId, header.position, header.streamId)
+		}
+	})
+	return streams, types, referenced, count
+}
+
+// forEachEntry calls fn for every entry of an index, reporting an entry that
+// can't be read as a problem.
+func (me *verifier) forEachEntry(filename string, fn func(*IndexEntry)) {
+	indexFile, err := os.OpenFile(filename, os.O_RDONLY, 0)
+	if err != nil {
+		me.problem("%v", err)
+		return
+	}
+	defer indexFile.Close()
+
+	for {
+		entry, err := readIndexNextEntry(indexFile, me.storage.format)
+		if err != nil && err.Error() == "EOF" {
+			return
+		}
+		if err != nil {
+			me.problem("%s: %v", filename, err)
+			return
+		}
+		fn(entry)
+	}
+}
+
+func (me *verifier) verifyStreamIndexes(streams map[uuid.UUID][]string) (int, error) {
+	files, err := ioutil.ReadDir(me.storage.indexesPath)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, file := range files {
+		filename := path.Join(me.storage.indexesPath, file.Name())
+		if filename == me.storage.globalIndexFilename || filename == me.storage.typesIndexesPath || filename == me.storage.journalFilename {
+			continue
+		}
+		streamId, err := uuid.FromString(file.Name())
+		if err != nil || file.IsDir() {
+			me.problem("%s isn't a stream index", filename)
+			continue
+		}
+		count++
+
+		expected, found := streams[streamId]
+		if !found {
+			me.problem("%s: stream isn't in the global index", filename)
+		}
+		delete(streams, streamId)
+		actual := make([]string, 0, len(expected))
+		me.forEachEntry(filename, func(entry *IndexEntry) {
+			if entry.streamId != streamId {
+				me.problem("%s: entry %v belongs to stream %v", filename, len(actual), entry.streamId)
+			}
+			actual = append(actual, me.storage.getEventFilename(entry))
+		})
+		me.compareEntries(filename, actual, expected)
+	}
+
+	for streamId, expected := range streams {
+		me.problem("%s: missing, the global index has %v events in the stream", me.storage.getStreamIndexFilename(streamId), len(expected))
+	}
+	return count, nil
+}
+
+func (me *verifier) verifyTypeIndexes(types map[string][]string) (int, error) {
+	files, err := ioutil.ReadDir(me.storage.typesIndexesPath)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	for _, file := range files {
+		filename := path.Join(me.storage.typesIndexesPath, file.Name())
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			me.problem("%v", err)
+			continue
+		}
+		actual := strings.Split(string(content), string(CRLF))
+		if last := actual[len(actual)-1]; last != "" {
+			me.problem("%s: incomplete last line %q", filename, last)
+		}
+		expected, found := types[file.Name()]
+		if !found {
+			me.problem("%s: type isn't in the global index", filename)
+		}
+		delete(types, file.Name())
+		me.compareEntries(filename, actual[:len(actual)-1], expected)
+	}
+
+	for typeId, expected := range types {
+		me.problem("%s: missing, the global index has %v events of the type", me.storage.getTypeIndexFilename(typeId), len(expected))
+	}
+	return len(files), nil
+}
+
+// compareEntries reports the first difference between the event files
+// referenced by an index and those expected from the global index.
+func (me *verifier) compareEntries(filename string, actual []string, expected []string) {
+	for i := 0; i < len(actual) && i < len(expected); i++ {
+		if actual[i] != expected[i] {
+			me.problem("%s: entry %v references %s, the global index has %s", filename, i, actual[i], expected[i])
+			return
+		}
+	}
+	if len(actual) != len(expected) {
+		me.problem("%s: %v entries, the global index has %v", filename, len(actual), len(expected))
+	}
+}
+
+// verifyEventFiles reports event files of the YYYYMM/DD tree that no index
+// entry references.
+func (me *verifier) verifyEventFiles(referenced map[string]bool) error {
+	return me.storage.forEachEventFile(func(filename string) error {
+		if !referenced[filename] {
+			me.problem("%s isn't referenced by the global index", filename)
+		}
+		return nil
+	})
+}
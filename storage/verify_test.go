@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newVerifyTestStorage(t *testing.T) (*DailyDiskStorage, []*IndexEntry) {
+	storage := NewDailyDiskStorage(path.Join(os.TempDir(), uuid.NewV4().String())).(*DailyDiskStorage)
+	streams := []uuid.UUID{uuid.NewV4(), uuid.NewV4()}
+	entries := make([]*IndexEntry, 0)
+	for i := 0; i < 6; i++ {
+		event := &StoredEvent{streams[i%2], time.Now(), []string{"aType", "anotherType", "aThirdType"}[i%3], []byte("{}"), "Metadata", []byte("{}")}
+		if err := storage.Write(event); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, &IndexEntry{event.StreamId, uint64(i), event.CreationTime, event.TypeId})
+	}
+	return storage, entries
+}
+
+func TestVerifyHealthyStorage(t *testing.T) {
+	//Arrange
+	storage, _ := newVerifyTestStorage(t)
+	defer os.RemoveAll(storage.storagePath)
+	out := new(bytes.Buffer)
+
+	//Act
+	problems, err := VerifyDailyDiskStorage(storage.storagePath, out)
+
+	//Assert
+	if err != nil || problems != 0 {
+		t.Errorf("Verify failed. Got %v problems and error %v, expected none. Report:\n%s", problems, err, out)
+	}
+	if !strings.Contains(out.String(), "Verified 6 events, 2 streams and 3 types: 0 problems.") {
+		t.Errorf("Verify failed. Unexpected report:\n%s", out)
+	}
+}
+
+func TestVerifyReportsProblems(t *testing.T) {
+	//Arrange
+	storage, entries := newVerifyTestStorage(t)
+	defer os.RemoveAll(storage.storagePath)
+	os.Remove(storage.getEventFilename(entries[1]))
+	ioutil.WriteFile(storage.getTypeIndexFilename("aType"), []byte("20160101/01/000000000000000_0_aType\r\n"), 0644)
+	os.Remove(storage.getStreamIndexFilename(entries[0].streamId))
+	orphan := &IndexEntry{entries[0].streamId, 6, time.Now(), "aType"}
+	writeEvent(storage.getEventFilename(orphan), orphan, &StoredEvent{Data: []byte("{}")}, false)
+	out := new(bytes.Buffer)
+
+	//Act
+	problems, err := VerifyDailyDiskStorage(storage.storagePath, out)
+
+	//Assert
+	if err != nil {
+		t.Fatalf("Verify failed. Error: %v", err)
+	}
+	expected := []string{
+		"event at position 1 of stream " + entries[1].streamId.String(),
+		"types/aType: entry 0 references 20160101/01/000000000000000_0_aType",
+		entries[0].streamId.String() + ": missing, the global index has 3 events",
+		storage.getEventFilename(orphan) + " isn't referenced",
+	}
+	for _, problem := range expected {
+		if !strings.Contains(out.String(), problem) {
+			t.Errorf("Verify failed. Expected report to contain %q. Report:\n%s", problem, out)
+		}
+	}
+	if problems != len(expected) {
+		t.Errorf("Verify failed. Got %v problems, expected %v. Report:\n%s", problems, len(expected), out)
+	}
+}
+
+func TestVerifyMissingStorage(t *testing.T) {
+	//Act
+	_, err := VerifyDailyDiskStorage(path.Join(os.TempDir(), uuid.NewV4().String()), new(bytes.Buffer))
+
+	//Assert
+	if err == nil {
+		t.Error("Verify failed. Expected an error for a missing storage.")
+	}
+}